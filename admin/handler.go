@@ -0,0 +1,74 @@
+package admin
+
+import (
+  "encoding/json"
+  "net/http"
+  "strings"
+  "breaker"
+)
+
+// http handler changing circuit mode
+//   POST /<name>/force-open - short circuit all calls
+//   POST /<name>/force-close - allow all calls
+//   POST /<name>/auto - return to automatic mode
+//   POST /<name>/reset - reset rolling metrics
+// mount with http.StripPrefix, e.g. http.Handle("/admin/circuits/", http.StripPrefix("/admin/circuits", handler))
+type Handler struct {
+  registry *breaker.Registry
+}
+
+func NewHandler(registry *breaker.Registry) *Handler {
+  return &Handler{registry: registry}
+}
+
+var actions = map[string]func(circuit *breaker.Circuit){
+  "force-open":  (*breaker.Circuit).ForceOpen,
+  "force-close": (*breaker.Circuit).ForceClose,
+  "auto":        (*breaker.Circuit).AutomaticMode,
+  "reset":       (*breaker.Circuit).ResetMetrics,
+}
+
+// circuit after action
+type response struct {
+  Name  string `json:"name"`
+  State string `json:"state"`
+  Mode  string `json:"mode"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodPost {
+    w.Header().Set("Allow", http.MethodPost)
+    http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    return
+  }
+
+  // circuit name may contain slashes - action is last path element
+  path := strings.TrimPrefix(r.URL.Path, "/")
+  i := strings.LastIndex(path, "/")
+  if i < 1 {
+    http.NotFound(w, r)
+    return
+  }
+
+  name, action := path[:i], actions[path[i+1:]]
+  if action == nil {
+    http.NotFound(w, r)
+    return
+  }
+
+  // don't create circuits for unknown names
+  circuit, ok := h.registry.Lookup(name)
+  if !ok {
+    http.Error(w, "unknown circuit "+name, http.StatusNotFound)
+    return
+  }
+
+  action(circuit)
+
+  w.Header().Set("Content-Type", "application/json")
+  json.NewEncoder(w).Encode(response{
+    Name:  circuit.Name(),
+    State: circuit.State().String(),
+    Mode:  circuit.Mode().String(),
+  })
+}
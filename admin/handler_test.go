@@ -0,0 +1,84 @@
+package admin
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "context"
+  "encoding/json"
+  "net/http"
+  "net/http/httptest"
+  "time"
+  "breaker"
+)
+
+func Test_Handler(t *testing.T) {
+  Convey("change circuit mode", t, func() {
+    registry := breaker.NewRegistry()
+    circuit := registry.NewCircuit("payments/api", breaker.Settings{})
+    handler := NewHandler(registry)
+
+    Convey("force open circuit", func() {
+      code, body := serve(handler, "POST", "/payments/api/force-open")
+
+      So(code, ShouldEqual, http.StatusOK)
+      So(body["state"], ShouldEqual, "open")
+      So(body["mode"], ShouldEqual, "forced open")
+      So(circuit.AllowRequest(), ShouldBeFalse)
+
+      Convey("return to automatic mode", func() {
+        code, body := serve(handler, "POST", "/payments/api/auto")
+
+        So(code, ShouldEqual, http.StatusOK)
+        So(body["mode"], ShouldEqual, "automatic")
+        So(circuit.Mode(), ShouldEqual, breaker.Automatic)
+      })
+    })
+
+    Convey("force close circuit", func() {
+      code, body := serve(handler, "POST", "/payments/api/force-close")
+
+      So(code, ShouldEqual, http.StatusOK)
+      So(body["state"], ShouldEqual, "closed")
+      So(circuit.Mode(), ShouldEqual, breaker.ForcedClosed)
+    })
+
+    Convey("reset metrics", func() {
+      circuit.Do(context.Background(), func(ctx context.Context) error {
+        return nil
+      }, nil)
+      code, _ := serve(handler, "POST", "/payments/api/reset")
+
+      So(code, ShouldEqual, http.StatusOK)
+      So(circuit.Metrics().Snapshot(time.Now()).Requests, ShouldEqual, 0)
+    })
+
+    Convey("unknown circuit is not created", func() {
+      code, _ := serve(handler, "POST", "/orders/force-open")
+
+      So(code, ShouldEqual, http.StatusNotFound)
+      So(len(registry.Circuits()), ShouldEqual, 1)
+    })
+
+    Convey("unknown action is rejected", func() {
+      code, _ := serve(handler, "POST", "/payments/api/explode")
+      So(code, ShouldEqual, http.StatusNotFound)
+    })
+
+    Convey("only post is allowed", func() {
+      code, _ := serve(handler, "GET", "/payments/api/force-open")
+      So(code, ShouldEqual, http.StatusMethodNotAllowed)
+    })
+  })
+}
+
+// calls handler and returns response code and parsed body
+func serve(handler http.Handler, method string, path string) (int, map[string]interface{}) {
+  request := httptest.NewRequest(method, path, nil)
+  recorder := httptest.NewRecorder()
+  handler.ServeHTTP(recorder, request)
+
+  body := map[string]interface{}{}
+  json.Unmarshal(recorder.Body.Bytes(), &body)
+
+  return recorder.Code, body
+}
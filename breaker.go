@@ -5,124 +5,337 @@ import (
   "context"
   "breaker/errors"
   "fmt"
+  "sync/atomic"
+  "breaker/clock"
+  bsync "breaker/sync"
 )
 
+// runs exec and returns channel with its error
+// channel is closed when exec (and fail func on error) is done
 func Go(name string, context context.Context,
   exec func(context.Context) error,
   fail func(context.Context, error) error) chan error {
-  circuit := getCircuit(name)
+  return getCircuit(name).Go(context, exec, fail)
+}
 
-  timeout := GetSettings(circuit.name).Timeout
-  timer := time.NewTicker(timeout)
+// runs exec and waits for its result
+// returns exec error or fail func error if fail func is defined
+func Do(name string, ctx context.Context,
+  exec func(context.Context) error,
+  fail func(context.Context, error) error) error {
+  return getCircuit(name).Do(ctx, exec, fail)
+}
 
-  executor := executor{
-    execCmd: exec,
-    failCmd: fail,
-    start:   time.Now(),
-    done:    make(chan bool, 1),
-    err:     make(chan error, 1),
+// runs exec and waits for its result
+// returns value from exec or from fallback if exec fails and fallback is defined
+func Execute[T any](name string, ctx context.Context,
+  exec func(context.Context) (T, error),
+  fallback func(context.Context, error) (T, error)) (T, error) {
+  return ExecuteCircuit(getCircuit(name), ctx, exec, fallback)
+}
+
+// runs exec on circuit and returns channel with its error
+// channel is closed when exec (and fail func on error) is done
+func (circuit *Circuit) Go(context context.Context,
+  exec func(context.Context) error,
+  fail func(context.Context, error) error) chan error {
+  errChan := make(chan error, 1)
+
+  if err := circuit.Do(context, exec, fail); err != nil {
+    errChan <- err
   }
 
-  ticket := circuit.limiter.TakeOrNil()
-  defer circuit.limiter.Return(ticket)
+  close(errChan)
+  return errChan
+}
 
-  if ticket == nil {
-    executor.fail(context, circuit, errors.ConcurrentLimitError)
-  } else {
-    go func() {
-      executor.execute(context, circuit)
-    }()
+// runs exec on circuit and waits for its result
+// returns exec error or fail func error if fail func is defined
+func (circuit *Circuit) Do(ctx context.Context,
+  exec func(context.Context) error,
+  fail func(context.Context, error) error) error {
+  var fallback func(context.Context, error) (struct{}, error)
 
-    select {
-    case <-context.Done():
-      executor.fail(context, circuit, errors.CancelledError)
-    case <-timer.C:
-      executor.fail(context, circuit, errors.TimeoutError)
-    case <-executor.done:
-      break
+  if fail != nil {
+    fallback = func(ctx context.Context, err error) (struct{}, error) {
+      return struct{}{}, fail(ctx, err)
     }
   }
 
-  return executor.err
+  _, err := ExecuteCircuit(circuit, ctx, func(ctx context.Context) (struct{}, error) {
+    return struct{}{}, exec(ctx)
+  }, fallback)
+
+  return err
 }
 
-type executor struct {
-  execCmd func(context.Context) error
-  failCmd func(context.Context, error) error
-  start   time.Time
-  end     time.Time
-  done    chan bool
-  err     chan error
-  failed  bool
+// runs exec on circuit and waits for its result
+// returns value from exec or from fallback if exec fails and fallback is defined
+func ExecuteCircuit[T any](circuit *Circuit, ctx context.Context,
+  exec func(context.Context) (T, error),
+  fallback func(context.Context, error) (T, error)) (T, error) {
+  executor := executor[T]{
+    execCmd: exec,
+    failCmd: fallback,
+    start:   circuit.registry.clock.Now(),
+  }
+
+  return executor.run(ctx, circuit)
 }
 
-func (e *executor) execute(ctx context.Context, circuit *circuit) {
-  defer func() {
-    e.done <- true
-    close(e.done)
+type executor[T any] struct {
+  execCmd   func(context.Context) (T, error)
+  failCmd   func(context.Context, error) (T, error)
+  start     time.Time
+  execStart time.Time // taken by exec goroutine, after queue and pool wait
+  execEnd   time.Time // zero if exec result was not awaited
+  end       time.Time
+  probe     bool
+
+  queued    bool // waited for limiter ticket
+  queueWait time.Duration
+  limiter   bsync.Limiter // limiter ticket was taken from, nil if call got no ticket
+}
+
+// exec goroutine status
+const (
+  execRunning int32 = iota
+  execReturned
+  execAbandoned // call returned on timeout or cancel before exec
+)
+
+// exec outcome passed from exec goroutine
+type result[T any] struct {
+  value T
+  err   error
+  start time.Time
+  end   time.Time
+}
+
+func (e *executor[T]) run(ctx context.Context, circuit *Circuit) (T, error) {
+  allowed, probe := circuit.allowRequest()
+  e.probe = probe
+
+  if !allowed {
+    return e.fail(ctx, circuit, errors.CircuitBrokenError)
+  }
+
+  settings := circuit.Settings()
+
+  // time spent in queue counts against timeout
+  timer := circuit.registry.clock.NewTimer(settings.Timeout)
+  defer timer.Stop()
 
-    if !e.failed {
-      e.end = time.Now()
-      circuit.reportEvent(event{rootEvent: success})
+  limiter := circuit.Limiter()
+  ticket := limiter.TakeOrNil()
+  // ticket of abandoned exec can be returned by exec goroutine
+  held := false
+  defer func() {
+    if !held {
+      limiter.Return(ticket)
     }
   }()
 
-  err := e.execCmdWrapper(ctx, circuit)
-  if err != nil {
-    e.fail(ctx, circuit, err)
+  if ticket == nil {
+    var err error
+    if ticket, err = e.waitTicket(ctx, circuit, limiter, settings, timer); err != nil {
+      return e.fail(ctx, circuit, err)
+    }
   }
-}
 
-func (e *executor) fail(ctx context.Context, circuit *circuit, execError error) {
-  e.failed = true
+  e.limiter = limiter
 
-  var failError error
-  defer func() {
-    e.end = time.Now()
+  // buffered - exec goroutine must not block if result is abandoned
+  done := make(chan result[T], 1)
+  status := execRunning
+  hold := settings.HoldAbandonedTickets
 
-    if e.failCmd != nil {
-      circuit.reportEvent(event{translateError(execError), translateFallbackError(failError)})
-    } else {
-      circuit.reportEvent(event{rootEvent: translateError(execError)})
+  task := func() {
+    // call returned while task waited for pool worker
+    if atomic.LoadInt32(&status) == execAbandoned {
+      circuit.finishAbandoned(limiter, ticket, hold)
+      return
     }
 
-    close(e.err)
-  }()
+    start := circuit.registry.clock.Now()
+    value, err := e.execCmdWrapper(ctx)
+    done <- result[T]{value, err, start, circuit.registry.clock.Now()}
 
-  if e.failCmd != nil {
-    failError = e.failCmdWrapper(ctx, circuit, execError)
+    if !atomic.CompareAndSwapInt32(&status, execRunning, execReturned) {
+      circuit.finishAbandoned(limiter, ticket, hold)
+    }
+  }
 
-    if failError != nil {
-      e.err <- failError
+  if pool := circuit.WorkerPool(); pool != nil {
+    if !pool.Submit(task) {
+      return e.fail(ctx, circuit, errors.PoolRejectedError)
     }
   } else {
-    e.err <- execError
+    go task()
+  }
+
+  // stop waiting for exec
+  abandon := func() {
+    if atomic.CompareAndSwapInt32(&status, execRunning, execAbandoned) {
+      atomic.AddInt64(&circuit.abandoned, 1)
+      held = hold
+    }
+  }
+
+  select {
+  case <-ctx.Done():
+    abandon()
+    return e.fail(ctx, circuit, errors.CancelledError)
+  case <-timer.C():
+    abandon()
+    return e.fail(ctx, circuit, errors.TimeoutError)
+  case result := <-done:
+    e.execStart = result.start
+    e.execEnd = result.end
+
+    if result.err != nil {
+      if e.failCmd == nil {
+        e.report(circuit, event{rootEvent: translateError(result.err), probe: e.probe})
+        return result.value, result.err
+      }
+
+      return e.fail(ctx, circuit, result.err)
+    }
+
+    e.report(circuit, event{rootEvent: success, probe: e.probe})
+    return result.value, nil
+  }
+}
+
+// waits in queue for limiter ticket
+// call is rejected if queue is full or ticket is not taken in max queue wait
+func (e *executor[T]) waitTicket(ctx context.Context, circuit *Circuit, limiter bsync.Limiter, settings Settings, timeout clock.Timer) (*struct{}, error) {
+  if settings.MaxQueueSize <= 0 {
+    return nil, errors.ConcurrentLimitError
+  }
+
+  if atomic.AddInt64(&circuit.queued, 1) > int64(settings.MaxQueueSize) {
+    atomic.AddInt64(&circuit.queued, -1)
+    return nil, errors.ConcurrentLimitError
+  }
+
+  start := circuit.registry.clock.Now()
+  e.queued = true
+
+  defer func() {
+    atomic.AddInt64(&circuit.queued, -1)
+    e.queueWait = circuit.registry.clock.Now().Sub(start)
+  }()
+
+  var wait <-chan time.Time
+  if settings.MaxQueueWait > 0 {
+    waitTimer := circuit.registry.clock.NewTimer(settings.MaxQueueWait)
+    defer waitTimer.Stop()
+
+    wait = waitTimer.C()
+  }
+
+  for {
+    select {
+    case ticket, ok := <-limiter.Take():
+      // channel is closed by limiter resize - retry
+      if ok {
+        return ticket, nil
+      }
+    case <-wait:
+      return nil, errors.ConcurrentLimitError
+    case <-timeout.C():
+      return nil, errors.TimeoutError
+    case <-ctx.Done():
+      return nil, errors.CancelledError
+    }
+  }
+}
+
+func (e *executor[T]) fail(ctx context.Context, circuit *Circuit, execError error) (T, error) {
+  if e.failCmd == nil {
+    e.report(circuit, event{rootEvent: translateError(execError), probe: e.probe})
+
+    var zero T
+    return zero, execError
+  }
+
+  value, failError := e.failCmdWrapper(ctx, execError)
+  e.report(circuit, event{
+    rootEvent:     translateError(execError),
+    fallbackEvent: translateFallbackError(failError),
+    probe:         e.probe,
+  })
+
+  return value, failError
+}
+
+func (e *executor[T]) report(circuit *Circuit, event event) {
+  e.end = circuit.registry.clock.Now()
+
+  if !e.execEnd.IsZero() {
+    event.executed = true
+    event.executionLatency = e.execEnd.Sub(e.execStart)
+  }
+
+  event.totalLatency = e.end.Sub(e.start)
+  event.queued = e.queued
+  event.queueWait = e.queueWait
+  e.observe(event)
+  circuit.reportEvent(event)
+
+  circuit.registry.notifyExecution(Execution{
+    Name:      circuit.name,
+    Event:     event.rootEvent,
+    Fallback:  event.fallbackEvent,
+    Slow:      isSlow(event, circuit.Settings()),
+    Latency:   event.totalLatency,
+    QueueWait: event.queueWait,
+  })
+}
+
+// feeds adaptive limiter with calls made with its ticket
+// cancelled and rejected calls say nothing about limit,
+// timed out exec has not returned - its latency is at least time since ticket was taken
+func (e *executor[T]) observe(event event) {
+  adaptive, ok := e.limiter.(bsync.AdaptiveLimiter)
+  if !ok {
+    return
+  }
+
+  switch event.rootEvent {
+  case success, failure:
+    adaptive.Observe(event.executionLatency, event.rootEvent != success)
+  case timeout:
+    adaptive.Observe(event.totalLatency-event.queueWait, true)
   }
 }
 
-func (e *executor) execCmdWrapper(ctx context.Context, circuit *circuit) error {
+func (e *executor[T]) execCmdWrapper(ctx context.Context) (value T, err error) {
   defer func() {
     if panicErr := recover(); panicErr != nil {
-      e.fail(ctx, circuit, fmt.Errorf("exec panic: %s", panicErr))
+      err = fmt.Errorf("exec panic: %s", panicErr)
     }
   }()
 
   return e.execCmd(ctx)
 }
 
-func (e *executor) failCmdWrapper(ctx context.Context, circuit *circuit, err error) error {
+func (e *executor[T]) failCmdWrapper(ctx context.Context, execError error) (value T, err error) {
   defer func() {
     if panicErr := recover(); panicErr != nil {
-      e.err <- fmt.Errorf("failover panic: %s", panicErr)
+      err = fmt.Errorf("failover panic: %s", panicErr)
     }
   }()
 
-  return e.failCmd(ctx, err)
+  return e.failCmd(ctx, execError)
 }
 
 func translateError(err error) eventType {
   switch err {
-  case errors.ConcurrentLimitError:
+  case errors.CircuitBrokenError:
+    return shortCircuited
+  case errors.ConcurrentLimitError, errors.PoolRejectedError:
     return rejected
   case errors.CancelledError:
     return cancelled
@@ -8,6 +8,9 @@ import (
   "breaker/errors"
   "fmt"
   "sync"
+  "sync/atomic"
+  "breaker/clock/fake"
+  bsync "breaker/sync"
 )
 
 func Test_Go(t *testing.T) {
@@ -19,6 +22,7 @@ func Test_Go(t *testing.T) {
       return nil
     }
 
+    resetCircuit("Test_Go")
     errChan := Go("Test_Go", context.Background(), executeCmd, nil)
 
     Convey("metrics are recorded", func() {
@@ -45,26 +49,36 @@ func Test_Go(t *testing.T) {
 func Test_Go_Timeout(t *testing.T) {
   Convey("run Go command", t, func() {
     resultChan := make(chan interface{}, 1)
+    release := make(chan struct{})
 
     executeCmd := func(ctx context.Context) error {
-      time.Sleep(2 * time.Second)
+      <-release
       return nil
     }
 
-    errChan := Go("Test_Go_Timeout", context.Background(), executeCmd, nil)
+    clock := fake.NewClock(time.Now())
+    circuit := NewRegistryWithClock(clock).Circuit("Test_Go_Timeout")
+
+    // time out exec as soon as its timer is started
+    go func() {
+      clock.BlockUntil(1)
+      clock.Advance(DefaultTimeout)
+    }()
+
+    errChan := circuit.Go(context.Background(), executeCmd, nil)
+    close(release)
 
     Convey("metrics are recorded", func() {
-      circuit := getCircuit("Test_Go_Timeout")
       circuit.mutex.RLock()
       defer circuit.mutex.RUnlock()
 
-      So(circuit.metrics.Requests().Sum(time.Now()), ShouldEqual, 1)
-      So(circuit.metrics.Errors().Sum(time.Now()), ShouldEqual, 1)
-      So(circuit.metrics.Rejects().Sum(time.Now()), ShouldEqual, 0)
-      So(circuit.metrics.Timeouts().Sum(time.Now()), ShouldEqual, 1)
-      So(circuit.metrics.Cancelled().Sum(time.Now()), ShouldEqual, 0)
-      So(circuit.metrics.FallbackSuccess().Sum(time.Now()), ShouldEqual, 0)
-      So(circuit.metrics.FallbackFailure().Sum(time.Now()), ShouldEqual, 0)
+      So(circuit.metrics.Requests().Sum(clock.Now()), ShouldEqual, 1)
+      So(circuit.metrics.Errors().Sum(clock.Now()), ShouldEqual, 1)
+      So(circuit.metrics.Rejects().Sum(clock.Now()), ShouldEqual, 0)
+      So(circuit.metrics.Timeouts().Sum(clock.Now()), ShouldEqual, 1)
+      So(circuit.metrics.Cancelled().Sum(clock.Now()), ShouldEqual, 0)
+      So(circuit.metrics.FallbackSuccess().Sum(clock.Now()), ShouldEqual, 0)
+      So(circuit.metrics.FallbackFailure().Sum(clock.Now()), ShouldEqual, 0)
     })
 
     Convey("reading from that channel should provide the expected value", func() {
@@ -84,6 +98,7 @@ func Test_Go_Failed(t *testing.T) {
       return fmt.Errorf("exec failure")
     }
 
+    resetCircuit("Test_Go_Failed")
     errChan := Go("Test_Go_Failed", context.Background(), executeCmd, nil)
 
     Convey("metrics are recorded", func() {
@@ -121,6 +136,7 @@ func Test_Go_FailoverSuccess(t *testing.T) {
       return nil
     }
 
+    resetCircuit("Test_Go_FailoverSuccess")
     errChan := Go("Test_Go_FailoverSuccess", context.Background(), executeCmd, failoverCmd)
 
     Convey("metrics are recorded", func() {
@@ -162,6 +178,7 @@ func Test_Go_FailoverFailure(t *testing.T) {
       return fmt.Errorf("failover failure")
     }
 
+    resetCircuit("Test_Go_FailoverFailure")
     errChan := Go("Test_Go_FailoverFailure", context.Background(), executeCmd, failoverCmd)
 
     Convey("metrics are recorded", func() {
@@ -195,6 +212,7 @@ func Test_Go_MaxConcurrentLimitReached(t *testing.T) {
     settings.MaxConcurrentCalls = 1
 
     ConfigureCircuit("Test_Go_MaxConcurrentLimitReached", settings)
+    resetCircuit("Test_Go_MaxConcurrentLimitReached")
 
     // 1st command waits for second to complete
     wg := sync.WaitGroup{}
@@ -270,6 +288,7 @@ func Test_Go_ExecPanic(t *testing.T) {
       panic("invalid data")
     }
 
+    resetCircuit("Test_Go_Panic")
     errChan := Go("Test_Go_Panic", context.Background(), executeCmd, nil)
 
     Convey("metrics are recorded", func() {
@@ -292,3 +311,566 @@ func Test_Go_ExecPanic(t *testing.T) {
     })
   })
 }
+
+func Test_Go_CircuitBroken(t *testing.T) {
+  Convey("run Go command on broken circuit", t, func() {
+    ConfigureCircuit("Test_Go_CircuitBroken", Settings{
+      ErrorThreshold:         0.5,
+      RequestVolumeThreshold: 1,
+    })
+
+    executeCmd := func(ctx context.Context) error {
+      return fmt.Errorf("exec failure")
+    }
+
+    // trip circuit and prevent single test
+    resetCircuit("Test_Go_CircuitBroken")
+    <-Go("Test_Go_CircuitBroken", context.Background(), executeCmd, nil)
+    circuit := getCircuit("Test_Go_CircuitBroken")
+    atomic.StoreInt64(&circuit.lastTested, time.Now().UnixNano())
+
+    execChan := make(chan interface{}, 1)
+    failoverChan := make(chan error, 1)
+
+    errChan := Go("Test_Go_CircuitBroken", context.Background(),
+      func(ctx context.Context) error {
+        execChan <- 1
+        return nil
+      },
+      func(ctx context.Context, err error) error {
+        failoverChan <- err
+        return nil
+      })
+
+    Convey("metrics are recorded", func() {
+      circuit.mutex.RLock()
+      defer circuit.mutex.RUnlock()
+
+      So(circuit.metrics.Requests().Sum(time.Now()), ShouldEqual, 1)
+      So(circuit.metrics.Errors().Sum(time.Now()), ShouldEqual, 1)
+      So(circuit.metrics.ShortCircuited().Sum(time.Now()), ShouldEqual, 1)
+      So(circuit.metrics.FallbackSuccess().Sum(time.Now()), ShouldEqual, 1)
+      So(circuit.metrics.FallbackFailure().Sum(time.Now()), ShouldEqual, 0)
+    })
+
+    Convey("command is not executed", func() {
+      So(len(execChan), ShouldEqual, 0)
+    })
+
+    Convey("failover receives circuit broken error", func() {
+      So(len(failoverChan), ShouldEqual, 1)
+      So(<-failoverChan, ShouldEqual, errors.CircuitBrokenError)
+    })
+
+    Convey("no error returned", func() {
+      So(len(errChan), ShouldEqual, 0)
+    })
+  })
+}
+
+// goconvey reruns setup for each leaf - start every run with new circuit
+func resetCircuit(name string) {
+  defaultRegistry.mutex.Lock()
+  defer defaultRegistry.mutex.Unlock()
+
+  delete(defaultRegistry.circuits, name)
+}
+
+func Test_Do(t *testing.T) {
+  Convey("run Do command", t, func() {
+    resetCircuit("Test_Do")
+
+    executed := false
+    err := Do("Test_Do", context.Background(), func(ctx context.Context) error {
+      executed = true
+      return nil
+    }, nil)
+
+    Convey("command is executed", func() {
+      So(executed, ShouldBeTrue)
+    })
+
+    Convey("no error returned", func() {
+      So(err, ShouldBeNil)
+    })
+  })
+}
+
+func Test_Do_Failed(t *testing.T) {
+  Convey("run Do command and fail", t, func() {
+    resetCircuit("Test_Do_Failed")
+
+    var failoverErr error
+    err := Do("Test_Do_Failed", context.Background(),
+      func(ctx context.Context) error {
+        return fmt.Errorf("exec failure")
+      },
+      func(ctx context.Context, err error) error {
+        failoverErr = err
+        return fmt.Errorf("failover failure")
+      })
+
+    Convey("metrics are recorded", func() {
+      circuit := getCircuit("Test_Do_Failed")
+      circuit.mutex.RLock()
+      defer circuit.mutex.RUnlock()
+
+      So(circuit.metrics.Requests().Sum(time.Now()), ShouldEqual, 1)
+      So(circuit.metrics.Errors().Sum(time.Now()), ShouldEqual, 1)
+      So(circuit.metrics.FallbackFailure().Sum(time.Now()), ShouldEqual, 1)
+    })
+
+    Convey("failover receives exec error", func() {
+      So(failoverErr, ShouldResemble, fmt.Errorf("exec failure"))
+    })
+
+    Convey("failover error returned", func() {
+      So(err, ShouldResemble, fmt.Errorf("failover failure"))
+    })
+  })
+}
+
+func Test_Do_Cancelled(t *testing.T) {
+  Convey("run Do command with cancelled context", t, func() {
+    resetCircuit("Test_Do_Cancelled")
+
+    ctx, cancel := context.WithCancel(context.Background())
+    cancel()
+
+    err := Do("Test_Do_Cancelled", ctx, func(ctx context.Context) error {
+      time.Sleep(time.Second)
+      return nil
+    }, nil)
+
+    Convey("cancelled error returned", func() {
+      So(err, ShouldEqual, errors.CancelledError)
+    })
+  })
+}
+
+func Test_Execute(t *testing.T) {
+  Convey("run Execute command", t, func() {
+    resetCircuit("Test_Execute")
+
+    value, err := Execute("Test_Execute", context.Background(), func(ctx context.Context) (string, error) {
+      return "result", nil
+    }, nil)
+
+    Convey("exec value returned", func() {
+      So(value, ShouldEqual, "result")
+      So(err, ShouldBeNil)
+    })
+  })
+}
+
+func Test_Execute_Timeout(t *testing.T) {
+  Convey("run Execute command which times out", t, func() {
+    ConfigureCircuit("Test_Execute_Timeout", Settings{Timeout: time.Millisecond * 10})
+    resetCircuit("Test_Execute_Timeout")
+
+    value, err := Execute("Test_Execute_Timeout", context.Background(),
+      func(ctx context.Context) (int, error) {
+        time.Sleep(time.Millisecond * 100)
+        return 1, nil
+      },
+      func(ctx context.Context, err error) (int, error) {
+        return -1, nil
+      })
+
+    Convey("fallback value returned", func() {
+      So(value, ShouldEqual, -1)
+      So(err, ShouldBeNil)
+    })
+  })
+}
+
+func Test_Execute_TimeoutNoFallback(t *testing.T) {
+  Convey("run Execute command which times out without fallback", t, func() {
+    ConfigureCircuit("Test_Execute_TimeoutNoFallback", Settings{Timeout: time.Millisecond * 10})
+    resetCircuit("Test_Execute_TimeoutNoFallback")
+
+    value, err := Execute("Test_Execute_TimeoutNoFallback", context.Background(),
+      func(ctx context.Context) (int, error) {
+        time.Sleep(time.Millisecond * 100)
+        return 1, nil
+      }, nil)
+
+    Convey("zero value and timeout error returned", func() {
+      So(value, ShouldEqual, 0)
+      So(err, ShouldEqual, errors.TimeoutError)
+    })
+  })
+}
+
+func Test_Do_Latency(t *testing.T) {
+  Convey("run Do commands", t, func() {
+    clock := fake.NewClock(time.Now())
+    circuit := NewRegistryWithClock(clock).NewCircuit("Test_Do_Latency", Settings{Timeout: time.Millisecond * 50})
+
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      clock.Advance(time.Millisecond * 20)
+      return nil
+    }, nil)
+
+    release := make(chan struct{})
+    defer close(release)
+
+    go func() {
+      clock.BlockUntil(1)
+      clock.Advance(time.Millisecond * 50)
+    }()
+
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      <-release
+      return nil
+    }, func(ctx context.Context, err error) error {
+      clock.Advance(time.Millisecond * 10)
+      return nil
+    })
+
+    Convey("latency is recorded", func() {
+      now := clock.Now()
+
+      executionLatency := circuit.metrics.ExecutionLatency()
+      So(executionLatency.Max(now), ShouldEqual, time.Millisecond*20)
+      So(executionLatency.Percentile(50, now), ShouldEqual, executionLatency.Max(now))
+
+      totalLatency := circuit.metrics.TotalLatency()
+      So(totalLatency.Max(now), ShouldEqual, time.Millisecond*60)
+      So(totalLatency.Percentile(0, now), ShouldEqual, time.Millisecond*20)
+    })
+  })
+}
+
+func Test_Do_AbandonedExec(t *testing.T) {
+  for _, hold := range []bool{true, false} {
+    Convey(fmt.Sprintf("time out hung exec with hold abandoned tickets %v", hold), t, func() {
+      clock := fake.NewClock(time.Now())
+      circuit := NewRegistryWithClock(clock).NewCircuit("abandoned", Settings{
+        MaxConcurrentCalls:   1,
+        HoldAbandonedTickets: hold,
+      })
+
+      release := make(chan struct{})
+
+      go func() {
+        clock.BlockUntil(1)
+        clock.Advance(DefaultTimeout)
+      }()
+
+      err1 := circuit.Do(context.Background(), func(ctx context.Context) error {
+        <-release
+        return nil
+      }, nil)
+
+      abandoned := circuit.Abandoned()
+      freeTickets := circuit.Limiter().Size()
+
+      err2 := circuit.Do(context.Background(), func(ctx context.Context) error {
+        return nil
+      }, nil)
+
+      close(release)
+      for circuit.Abandoned() > 0 {
+        time.Sleep(time.Millisecond)
+      }
+
+      Convey("call is timed out and exec is abandoned", func() {
+        So(err1, ShouldEqual, errors.TimeoutError)
+        So(abandoned, ShouldEqual, 1)
+      })
+
+      if hold {
+        Convey("ticket is held until exec returns", func() {
+          So(freeTickets, ShouldEqual, 0)
+          So(err2, ShouldEqual, errors.ConcurrentLimitError)
+          So(circuit.Limiter().Size(), ShouldEqual, 1)
+        })
+      } else {
+        Convey("ticket is returned with call", func() {
+          So(freeTickets, ShouldEqual, 1)
+          So(err2, ShouldBeNil)
+        })
+      }
+    })
+  }
+}
+
+func Test_Do_Queue(t *testing.T) {
+  Convey("run Do commands above concurrent calls limit with queue", t, func() {
+    clock := fake.NewClock(time.Now())
+    circuit := NewRegistryWithClock(clock).NewCircuit("queue", Settings{
+      MaxConcurrentCalls: 1,
+      MaxQueueSize:       1,
+      MaxQueueWait:       time.Millisecond * 100,
+    })
+
+    release := make(chan struct{})
+    running := make(chan error, 1)
+    queued := make(chan error, 1)
+
+    go func() {
+      running <- circuit.Do(context.Background(), func(ctx context.Context) error {
+        <-release
+        return nil
+      }, nil)
+    }()
+    // timeout timer of running call
+    clock.BlockUntil(1)
+
+    go func() {
+      queued <- circuit.Do(context.Background(), func(ctx context.Context) error {
+        clock.Advance(time.Millisecond * 80)
+        return nil
+      }, nil)
+    }()
+    // timeout and queue wait timers of queued call
+    clock.BlockUntil(3)
+
+    depth := circuit.Queued()
+
+    rejected := circuit.Do(context.Background(), func(ctx context.Context) error {
+      return nil
+    }, nil)
+
+    clock.Advance(time.Millisecond * 50)
+    close(release)
+
+    Convey("call waits in queue for ticket", func() {
+      So(depth, ShouldEqual, 1)
+      So(<-running, ShouldBeNil)
+      So(<-queued, ShouldBeNil)
+      So(circuit.Queued(), ShouldEqual, 0)
+    })
+
+    Convey("call is rejected if queue is full", func() {
+      So(rejected, ShouldEqual, errors.ConcurrentLimitError)
+    })
+
+    Convey("queue metrics are recorded", func() {
+      <-queued
+      snapshot := circuit.Metrics().Snapshot(clock.Now())
+
+      So(snapshot.Rejects, ShouldEqual, 1)
+      So(snapshot.QueueWait.Count, ShouldEqual, 1)
+      So(snapshot.QueueWait.Max, ShouldEqual, time.Millisecond*50)
+    })
+
+    Convey("queue wait is not part of execution latency", func() {
+      <-queued
+      snapshot := circuit.Metrics().Snapshot(clock.Now())
+
+      So(snapshot.ExecutionLatency.Max, ShouldEqual, time.Millisecond*80)
+      So(snapshot.TotalLatency.Max, ShouldEqual, time.Millisecond*130)
+    })
+  })
+}
+
+func Test_Do_QueueWait(t *testing.T) {
+  Convey("wait in queue longer than max queue wait", t, func() {
+    clock := fake.NewClock(time.Now())
+    circuit := NewRegistryWithClock(clock).NewCircuit("queue wait", Settings{
+      MaxConcurrentCalls: 1,
+      MaxQueueSize:       1,
+      MaxQueueWait:       time.Millisecond * 100,
+    })
+
+    release := make(chan struct{})
+    defer close(release)
+
+    go circuit.Do(context.Background(), func(ctx context.Context) error {
+      <-release
+      return nil
+    }, nil)
+    clock.BlockUntil(1)
+
+    go func() {
+      clock.BlockUntil(3)
+      clock.Advance(time.Millisecond * 100)
+    }()
+
+    err := circuit.Do(context.Background(), func(ctx context.Context) error {
+      return nil
+    }, nil)
+
+    Convey("call is rejected", func() {
+      So(err, ShouldEqual, errors.ConcurrentLimitError)
+      So(circuit.Metrics().Snapshot(clock.Now()).QueueWait.Max, ShouldEqual, time.Millisecond*100)
+    })
+  })
+}
+
+func Test_Do_WorkerPool(t *testing.T) {
+  Convey("run Do commands in worker pool", t, func() {
+    clock := fake.NewClock(time.Now())
+    registry := NewRegistryWithClock(clock)
+    settings := Settings{
+      Isolation:   PoolIsolation,
+      PoolWorkers: 1,
+      PoolGroup:   "payments",
+    }
+    circuit1 := registry.NewCircuit("pool1", settings)
+    circuit2 := registry.NewCircuit("pool2", settings)
+
+    release := make(chan struct{})
+    running := make(chan error, 1)
+
+    go func() {
+      running <- circuit1.Do(context.Background(), func(ctx context.Context) error {
+        <-release
+        return nil
+      }, nil)
+    }()
+    clock.BlockUntil(1)
+
+    rejected1 := circuit1.Do(context.Background(), func(ctx context.Context) error {
+      return nil
+    }, nil)
+    rejected2 := circuit2.Do(context.Background(), func(ctx context.Context) error {
+      return nil
+    }, nil)
+
+    close(release)
+
+    Convey("exec is run by pool worker", func() {
+      So(<-running, ShouldBeNil)
+      So(circuit1.WorkerPool().Workers(), ShouldEqual, 1)
+    })
+
+    Convey("call is rejected if pool is full", func() {
+      So(rejected1, ShouldEqual, errors.PoolRejectedError)
+      So(circuit1.Metrics().Snapshot(clock.Now()).Rejects, ShouldEqual, 1)
+    })
+
+    Convey("circuits of group share pool", func() {
+      So(rejected2, ShouldEqual, errors.PoolRejectedError)
+      So(circuit1.WorkerPool(), ShouldEqual, circuit2.WorkerPool())
+    })
+
+    Convey("goroutine isolated circuit has no pool", func() {
+      So(registry.Circuit("goroutine").WorkerPool(), ShouldBeNil)
+    })
+  })
+
+  Convey("run Do commands in group with different pool sizes", t, func() {
+    registry := NewRegistry()
+    circuit1 := registry.NewCircuit("small", Settings{Isolation: PoolIsolation, PoolWorkers: 1, PoolGroup: "mixed"})
+    circuit2 := registry.NewCircuit("large", Settings{Isolation: PoolIsolation, PoolWorkers: 2, PoolGroup: "mixed"})
+
+    pool1 := circuit1.WorkerPool()
+    pool2 := circuit2.WorkerPool()
+
+    for i := 0; i < 10; i++ {
+      circuit1.Do(context.Background(), func(ctx context.Context) error { return nil }, nil)
+      circuit2.Do(context.Background(), func(ctx context.Context) error { return nil }, nil)
+    }
+
+    Convey("circuits keep own pools", func() {
+      So(pool1 == pool2, ShouldBeFalse)
+      So(circuit1.WorkerPool(), ShouldEqual, pool1)
+      So(circuit2.WorkerPool(), ShouldEqual, pool2)
+    })
+
+    Convey("resized circuit gets pool of its size", func() {
+      circuit1.Configure(Settings{Isolation: PoolIsolation, PoolWorkers: 2, PoolGroup: "mixed"})
+      So(circuit1.WorkerPool(), ShouldEqual, pool2)
+    })
+
+    Convey("circuit switched to goroutine isolation releases pool", func() {
+      circuit1.Configure(Settings{Isolation: GoroutineIsolation})
+      So(circuit1.WorkerPool(), ShouldBeNil)
+
+      registry.poolsMutex.Lock()
+      defer registry.poolsMutex.Unlock()
+      So(len(registry.pools), ShouldEqual, 1)
+    })
+  })
+
+  Convey("run Do command waiting for pool worker", t, func() {
+    clock := fake.NewClock(time.Now())
+    circuit := NewRegistryWithClock(clock).NewCircuit("pool wait", Settings{
+      Isolation:     PoolIsolation,
+      PoolWorkers:   1,
+      PoolQueueSize: 1,
+    })
+
+    started := make(chan struct{})
+    release := make(chan struct{})
+    running := make(chan error, 1)
+    queued := make(chan error, 1)
+
+    go func() {
+      running <- circuit.Do(context.Background(), func(ctx context.Context) error {
+        close(started)
+        <-release
+        return nil
+      }, nil)
+    }()
+    <-started
+
+    go func() {
+      queued <- circuit.Do(context.Background(), func(ctx context.Context) error {
+        clock.Advance(time.Millisecond * 80)
+        return nil
+      }, nil)
+    }()
+    // timeout timers of both calls
+    clock.BlockUntil(2)
+
+    clock.Advance(time.Millisecond * 300)
+    close(release)
+
+    Convey("pool wait is not part of execution latency", func() {
+      So(<-running, ShouldBeNil)
+      So(<-queued, ShouldBeNil)
+
+      latency := circuit.Metrics().Snapshot(clock.Now()).ExecutionLatency
+      So(latency.Count, ShouldEqual, 2)
+      So(latency.Max, ShouldEqual, time.Millisecond*300)
+      So(latency.Mean, ShouldEqual, time.Millisecond*190)
+    })
+  })
+}
+
+func Test_Do_AdaptiveLimiter(t *testing.T) {
+  Convey("run failing Do commands with aimd limiter", t, func() {
+    registry := NewRegistry()
+    circuit := registry.NewCircuit("adaptive", Settings{
+      MaxConcurrentCalls:     10,
+      MinConcurrentCalls:     2,
+      LimiterType:            AIMDLimiter,
+      RequestVolumeThreshold: 100,
+    })
+
+    limit1 := circuit.ConcurrencyLimit()
+
+    for i := 0; i < 20; i++ {
+      circuit.Do(context.Background(), func(ctx context.Context) error {
+        return fmt.Errorf("exec failure")
+      }, nil)
+    }
+
+    Convey("failed calls lower limit down to min", func() {
+      So(limit1, ShouldEqual, 10)
+      So(circuit.ConcurrencyLimit(), ShouldEqual, 2)
+      So(circuit.Limiter().Size(), ShouldEqual, 2)
+    })
+
+    Convey("changing limiter type replaces limiter", func() {
+      settings := circuit.Settings()
+      settings.LimiterType = FixedLimiter
+      circuit.Configure(settings)
+
+      _, adaptive := circuit.Limiter().(bsync.AdaptiveLimiter)
+      So(adaptive, ShouldBeFalse)
+      So(circuit.ConcurrencyLimit(), ShouldEqual, 10)
+      So(circuit.Limiter().Size(), ShouldEqual, 10)
+    })
+
+    Convey("min above max is rejected", func() {
+      So(func() {
+        registry.ConfigureCircuit("adaptive", Settings{LimiterType: GradientLimiter, MinConcurrentCalls: 20, MaxConcurrentCalls: 10})
+      }, ShouldPanic)
+    })
+  })
+}
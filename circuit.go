@@ -6,105 +6,432 @@ import (
   "time"
   "sync/atomic"
   bsync "breaker/sync"
+  "breaker/clock"
 )
 
-var circuits map[string]*circuit
-var mutex sync.RWMutex
+// outcome of call and its fallback, see Execution
+type ExecutionEvent string
 
-type eventType string
+const (
+  SuccessEvent         ExecutionEvent = "success"
+  FailureEvent         ExecutionEvent = "failure"
+  RejectedEvent        ExecutionEvent = "rejected"
+  ShortCircuitedEvent  ExecutionEvent = "short circuited"
+  TimeoutEvent         ExecutionEvent = "timeout"
+  CancelledEvent       ExecutionEvent = "cancelled"
+  FallbackSuccessEvent ExecutionEvent = "fallback success"
+  FallbackFailureEvent ExecutionEvent = "fallback failure"
+)
+
+type eventType = ExecutionEvent
 
 const (
-  success         eventType = "success"
-  failure                   = "failure"
-  rejected                  = "rejected"
-  timeout                   = "timeout"
-  cancelled                 = "cancelled"
-  fallbackSuccess           = "fallback success"
-  fallbackFailure           = "fallback failure"
+  success         = SuccessEvent
+  failure         = FailureEvent
+  rejected        = RejectedEvent
+  shortCircuited  = ShortCircuitedEvent
+  timeout         = TimeoutEvent
+  cancelled       = CancelledEvent
+  fallbackSuccess = FallbackSuccessEvent
+  fallbackFailure = FallbackFailureEvent
 )
 
 type event struct {
   rootEvent     eventType
   fallbackEvent eventType
+  probe         bool // call was allowed as half open test
+
+  executed         bool // exec func returned before timeout or cancel
+  executionLatency time.Duration
+  totalLatency     time.Duration
+
+  queued    bool // call waited for limiter ticket
+  queueWait time.Duration
+}
+
+// circuit state
+// closed -> open -> half open -> closed or open
+type State int
+
+const (
+  Closed State = iota
+  Open
+  HalfOpen
+)
+
+func (state State) String() string {
+  switch state {
+  case Closed:
+    return "closed"
+  case Open:
+    return "open"
+  case HalfOpen:
+    return "half open"
+  }
+
+  return "unknown"
 }
 
-type circuit struct {
+// circuit handle
+// circuits are created by registry and shared by all calls with the same name
+type Circuit struct {
   name       string
+  registry   *Registry
   mutex      sync.RWMutex
   metrics    metrics.Collector
   limiter    bsync.Limiter
+  limiterKey limiterKey
+  pool       *bsync.WorkerPool // nil unless circuit uses pool isolation
+  window     metricsWindow
   lastTested int64 // init to 0
+  abandoned  int64 // execs still running after their calls returned
+  queued     int64 // calls waiting for limiter ticket
   events     chan event
+
+  // state changes waiting for listeners, queue is unbounded so transitions never wait for listeners
+  changesMutex sync.Mutex
+  changes      []StateChange
+  changed      chan struct{} // signals queued changes to circuit goroutine
+
+  stateMutex     sync.Mutex
+  state          State
+  mode           Mode
+  halfOpenCalls  int // probes in flight
+  halfOpenPassed int // successful probes
 }
 
-func init() {
-  circuits = make(map[string]*circuit)
-  mutex = sync.RWMutex{}
+// settings metrics collector is created with
+type metricsWindow struct {
+  windowType WindowType
+  calls      int
+  window     time.Duration
+  buckets    int
 }
 
-func getCircuit(name string) *circuit {
-  mutex.Lock()
-  defer mutex.Unlock()
+// settings limiter is created with, max concurrent calls are applied by resize
+type limiterKey struct {
+  limiterType LimiterType
+  minCalls    int
+}
 
-  if _, ok := circuits[name]; !ok {
-    settings := GetSettings(name)
+func limiterKeyOf(s Settings) limiterKey {
+  return limiterKey{s.LimiterType, s.MinConcurrentCalls}
+}
 
-    circuit := circuit{
-      name:    name,
-      metrics: metrics.NewCollector(),
-      limiter: bsync.NewLimiter(settings.MaxConcurrentCalls),
-      events:  make(chan event),
-    }
+func newLimiter(s Settings) bsync.Limiter {
+  switch s.LimiterType {
+  case AIMDLimiter:
+    return bsync.NewAIMDLimiter(s.MinConcurrentCalls, s.MaxConcurrentCalls)
+  case GradientLimiter:
+    return bsync.NewGradientLimiter(s.MinConcurrentCalls, s.MaxConcurrentCalls)
+  }
 
-    // listen to events
-    go func() {
-      // TODO allow to stop and exit loop
-      for {
-        select {
-        case event := <-circuit.events:
-          circuit.reportEvent(event)
-        }
-      }
-    }()
+  return bsync.NewLimiter(s.MaxConcurrentCalls)
+}
 
-    circuits[name] = &circuit
+func windowOf(s Settings) metricsWindow {
+  return metricsWindow{s.MetricsWindowType, s.MetricsWindowCalls, s.MetricsWindow, s.MetricsBuckets}
+}
+
+func newCollector(s Settings, clock clock.Clock) metrics.Collector {
+  if s.MetricsWindowType == CountWindow {
+    return metrics.NewCountCollector(s.MetricsWindowCalls)
   }
 
-  return circuits[name]
+  return metrics.NewCollector(s.MetricsWindow, uint(s.MetricsBuckets), clock)
 }
 
-func (circuit *circuit) AllowRequest() bool {
-  return !circuit.isBroken() || circuit.allowSingleTest()
+func getCircuit(name string) *Circuit {
+  return defaultRegistry.getCircuit(name)
 }
 
-// too many failed requests
-func (circuit *circuit) isBroken() bool {
-  settings := GetSettings(circuit.name)
+func (circuit *Circuit) Name() string {
+  return circuit.name
+}
 
-  metrics := circuit.metrics
+// rolling metrics of circuit
+// collector is replaced when window settings are changed
+func (circuit *Circuit) Metrics() metrics.Collector {
+  circuit.mutex.RLock()
+  defer circuit.mutex.RUnlock()
 
+  return circuit.metrics
+}
+
+// concurrent calls limiter of circuit
+// limiter is replaced when limiter type is changed
+func (circuit *Circuit) Limiter() bsync.Limiter {
   circuit.mutex.RLock()
   defer circuit.mutex.RUnlock()
 
-  now := time.Now()
-  requests := metrics.Requests().Sum(now)
-  errors := metrics.Errors().Sum(now)
+  return circuit.limiter
+}
+
+// current concurrent calls limit, max concurrent calls unless limiter is adaptive
+func (circuit *Circuit) ConcurrencyLimit() int {
+  if adaptive, ok := circuit.Limiter().(bsync.AdaptiveLimiter); ok {
+    return adaptive.Limit()
+  }
+
+  return circuit.Settings().MaxConcurrentCalls
+}
+
+// current settings of circuit
+func (circuit *Circuit) Settings() Settings {
+  return circuit.registry.GetSettings(circuit.name)
+}
+
+// change circuit settings, see Registry.ConfigureCircuit
+func (circuit *Circuit) Configure(s Settings) Settings {
+  return circuit.registry.ConfigureCircuit(circuit.name, s)
+}
+
+func (circuit *Circuit) AllowRequest() bool {
+  allowed, _ := circuit.allowRequest()
+  return allowed
+}
+
+// checks circuit state and moves it forward
+// returns if request is allowed and if it is half open probe
+func (circuit *Circuit) allowRequest() (allowed bool, probe bool) {
+  settings := circuit.Settings()
+
+  circuit.stateMutex.Lock()
+  defer circuit.stateMutex.Unlock()
+
+  switch circuit.mode {
+  case ForcedOpen:
+    return false, false
+  case ForcedClosed:
+    return true, false
+  }
+
+  switch circuit.state {
+  case Closed:
+    if !circuit.isBroken() {
+      return true, false
+    }
+
+    circuit.setState(Open)
+    return false, false
+  case Open:
+    if !circuit.allowSingleTest() {
+      return false, false
+    }
+
+    circuit.setState(HalfOpen)
+    circuit.halfOpenCalls++
+    return true, true
+  case HalfOpen:
+    if circuit.halfOpenCalls < settings.HalfOpenMaxCalls {
+      circuit.halfOpenCalls++
+      return true, true
+    }
+  }
+
+  return false, false
+}
+
+// time circuit was last opened or probed, zero if never
+func (circuit *Circuit) LastTested() time.Time {
+  lastTested := atomic.LoadInt64(&circuit.lastTested)
+  if lastTested == 0 {
+    return time.Time{}
+  }
+
+  return time.Unix(0, lastTested)
+}
+
+// number of execs still running after their calls timed out or were cancelled
+func (circuit *Circuit) Abandoned() int64 {
+  return atomic.LoadInt64(&circuit.abandoned)
+}
+
+// worker pool running execs, nil if circuit doesn't use pool isolation
+func (circuit *Circuit) WorkerPool() *bsync.WorkerPool {
+  circuit.mutex.RLock()
+  defer circuit.mutex.RUnlock()
+
+  return circuit.pool
+}
+
+// number of calls waiting for limiter ticket
+func (circuit *Circuit) Queued() int64 {
+  return atomic.LoadInt64(&circuit.queued)
+}
+
+// called by exec goroutine returned after its call
+// held ticket is returned to limiter it was taken from
+func (circuit *Circuit) finishAbandoned(limiter bsync.Limiter, ticket *struct{}, held bool) {
+  atomic.AddInt64(&circuit.abandoned, -1)
+
+  if held {
+    limiter.Return(ticket)
+  }
+}
+
+// current circuit state
+func (circuit *Circuit) State() State {
+  circuit.stateMutex.Lock()
+  defer circuit.stateMutex.Unlock()
+
+  return circuit.state
+}
+
+// applies changed settings to existing circuit
+// metrics are collected from scratch if window is changed
+// new limiter is created if limiter type is changed, calls running with old one aren't counted by it
+func (circuit *Circuit) applySettings(s Settings) {
+  circuit.mutex.Lock()
+  defer circuit.mutex.Unlock()
+
+  if key := limiterKeyOf(s); key != circuit.limiterKey {
+    circuit.limiterKey = key
+    circuit.limiter = newLimiter(s)
+  } else {
+    circuit.limiter.Resize(s.MaxConcurrentCalls)
+  }
+
+  if window := windowOf(s); window != circuit.window {
+    circuit.window = window
+    circuit.metrics = newCollector(s, circuit.registry.clock)
+  }
+
+  circuit.pool = circuit.registry.workerPool(circuit.name, s)
+}
+
+// must be called with state mutex locked
+func (circuit *Circuit) setState(state State) {
+  change := StateChange{
+    Name:    circuit.name,
+    From:    circuit.state,
+    To:      state,
+    Metrics: circuit.Metrics().Snapshot(circuit.registry.clock.Now()),
+  }
+
+  switch state {
+  case Open:
+    // sleep window starts from the moment circuit is opened
+    atomic.StoreInt64(&circuit.lastTested, circuit.registry.clock.Now().UnixNano())
+  case Closed:
+    // forget errors which opened circuit
+    circuit.Metrics().Reset()
+  }
+
+  circuit.state = state
+  circuit.halfOpenCalls = 0
+  circuit.halfOpenPassed = 0
+
+  // listeners are called from circuit goroutine
+  circuit.queueChange(change)
+}
+
+func (circuit *Circuit) queueChange(change StateChange) {
+  circuit.changesMutex.Lock()
+  circuit.changes = append(circuit.changes, change)
+  circuit.changesMutex.Unlock()
+
+  select {
+  case circuit.changed <- struct{}{}:
+  default:
+    // goroutine is already signalled
+  }
+}
+
+// queued changes in order of transitions
+func (circuit *Circuit) takeChanges() []StateChange {
+  circuit.changesMutex.Lock()
+  defer circuit.changesMutex.Unlock()
+
+  changes := circuit.changes
+  circuit.changes = nil
+
+  return changes
+}
+
+// half open circuit is closed after enough successful probes
+// and opened again by failed one
+func (circuit *Circuit) updateState(event event) {
+  if !event.probe {
+    return
+  }
+
+  settings := circuit.Settings()
+
+  circuit.stateMutex.Lock()
+  defer circuit.stateMutex.Unlock()
+
+  if circuit.state != HalfOpen || circuit.mode != Automatic {
+    return
+  }
 
-  if errors == 0 {
+  // probe could be started in previous half open period
+  if circuit.halfOpenCalls > 0 {
+    circuit.halfOpenCalls--
+  }
+
+  switch event.rootEvent {
+  case success:
+    circuit.halfOpenPassed++
+
+    if circuit.halfOpenPassed >= settings.HalfOpenSuccessThreshold {
+      circuit.setState(Closed)
+    }
+  case failure, timeout:
+    circuit.setState(Open)
+  }
+}
+
+// too many failed or slow requests
+func (circuit *Circuit) isBroken() bool {
+  settings := circuit.Settings()
+
+  // counters of the same calls, latency stats are not needed to trip
+  snapshot := circuit.Metrics().Counters(circuit.registry.clock.Now())
+
+  requests := snapshot.Requests
+  errors := snapshot.Errors
+  slowCalls := snapshot.SlowCalls
+
+  // not enough requests to evaluate ratios
+  if requests < volumeThreshold(settings) {
     return false
   }
 
-  return float32(errors)/float32(requests) >= settings.ErrorThreshold
+  if errors > 0 && float32(errors)/float32(requests) >= settings.ErrorThreshold {
+    return true
+  }
+
+  return slowCalls > 0 && float32(slowCalls)/float32(requests) >= settings.SlowCallRateThreshold
+}
+
+// count based window never holds more calls than its size
+func volumeThreshold(settings Settings) int64 {
+  if settings.MetricsWindowType == CountWindow && settings.RequestVolumeThreshold > int64(settings.MetricsWindowCalls) {
+    return int64(settings.MetricsWindowCalls)
+  }
+
+  return settings.RequestVolumeThreshold
+}
+
+// exec took longer than slow call duration
+// timed out exec is slow if timeout is not shorter than slow call duration
+func isSlow(event event, settings Settings) bool {
+  if event.executed {
+    return event.executionLatency >= settings.SlowCallDuration
+  }
+
+  return event.rootEvent == timeout && settings.Timeout >= settings.SlowCallDuration
 }
 
 // try once to check if circuit is restored
-func (circuit *circuit) allowSingleTest() bool {
-  settings := GetSettings(circuit.name)
+func (circuit *Circuit) allowSingleTest() bool {
+  settings := circuit.Settings()
 
   lastTested := atomic.LoadInt64(&circuit.lastTested)
   wakeupTime := lastTested + settings.SleepDuration.Nanoseconds()
 
-  now := time.Now().UnixNano()
+  now := circuit.registry.clock.Now().UnixNano()
 
   if wakeupTime < now {
     swapped := atomic.CompareAndSwapInt64(&circuit.lastTested, lastTested, now)
@@ -115,30 +442,57 @@ func (circuit *circuit) allowSingleTest() bool {
   return false
 }
 
-func (circuit *circuit) reportEvent(event event) {
-  circuit.mutex.Lock()
-  defer circuit.mutex.Unlock()
+func (circuit *Circuit) reportEvent(event event) {
+  circuit.recordEvent(event)
+  circuit.updateState(event)
+}
+
+func (circuit *Circuit) recordEvent(event event) {
+  settings := circuit.Settings()
+  metrics := circuit.Metrics()
 
-  metrics := circuit.metrics
-  metrics.Requests().Increment()
+  // counters of event are seen together by snapshot
+  metrics.Update(func(now time.Time) {
+    // short circuited calls never reach backend - keep them out of
+    // requests and errors so they don't hold circuit open
+    if event.rootEvent == shortCircuited {
+      metrics.ShortCircuited().AddAt(now, 1)
+    } else {
+      metrics.Requests().AddAt(now, 1)
 
-  if event.rootEvent != success {
-    metrics.Errors().Increment()
+      if event.rootEvent != success {
+        metrics.Errors().AddAt(now, 1)
 
-    switch event.rootEvent {
-    case rejected:
-      metrics.Rejects().Increment()
-    case timeout:
-      metrics.Timeouts().Increment()
-    case cancelled:
-      metrics.Cancelled().Increment()
+        switch event.rootEvent {
+        case rejected:
+          metrics.Rejects().AddAt(now, 1)
+        case timeout:
+          metrics.Timeouts().AddAt(now, 1)
+        case cancelled:
+          metrics.Cancelled().AddAt(now, 1)
+        }
+      }
     }
 
     switch event.fallbackEvent {
     case fallbackSuccess:
-      metrics.FallbackSuccess().Increment()
+      metrics.FallbackSuccess().AddAt(now, 1)
     case fallbackFailure:
-      metrics.FallbackFailure().Increment()
+      metrics.FallbackFailure().AddAt(now, 1)
     }
-  }
+
+    if isSlow(event, settings) {
+      metrics.SlowCalls().AddAt(now, 1)
+    }
+
+    if event.executed {
+      metrics.ExecutionLatency().AddAt(now, event.executionLatency)
+    }
+
+    if event.queued {
+      metrics.QueueWait().AddAt(now, event.queueWait)
+    }
+
+    metrics.TotalLatency().AddAt(now, event.totalLatency)
+  })
 }
@@ -7,11 +7,14 @@ import (
   "sync"
   "breaker/metrics"
   "fmt"
+  "sync/atomic"
+  "breaker/clock/fake"
 )
 
 func Test_allowSingleTest_Sequence(t *testing.T) {
   Convey("circuit singleTest in sequence", t, func() {
-    circuit := getCircuit("test")
+    clock := fake.NewClock(time.Now())
+    circuit := NewRegistryWithClock(clock).Circuit("test")
 
     allow1 := circuit.allowSingleTest()
     lastTested1 := circuit.lastTested
@@ -20,7 +23,7 @@ func Test_allowSingleTest_Sequence(t *testing.T) {
     lastTested2 := circuit.lastTested
 
     // default circuit sleep duration set to 1 sec
-    time.Sleep(time.Second)
+    clock.Advance(time.Second + time.Nanosecond)
     allow3 := circuit.allowSingleTest()
     lastTested3 := circuit.lastTested
 
@@ -37,7 +40,7 @@ func Test_allowSingleTest_Sequence(t *testing.T) {
 
 func Test_allowSingleTest_TwoParallelCalls(t *testing.T) {
   Convey("circuit singleTest in two parallel calls", t, func() {
-    circuit := getCircuit("test1")
+    circuit := NewRegistry().Circuit("test1")
 
     barrier := sync.WaitGroup{}
     barrier.Add(1)
@@ -80,7 +83,8 @@ func Test_isBroken(t *testing.T) {
 
     cases := []TestCase{
       {10, 0, false},
-      {0, 10, true},
+      {0, 10, false},
+      {9, 9, false},
       {10, 1, false},
       {10, 9, true},
       {10, 8, true},
@@ -88,13 +92,15 @@ func Test_isBroken(t *testing.T) {
 
     circuit := getCircuit("broken test1")
     ConfigureCircuit(circuit.name, Settings{
-      ErrorThreshold: 0.8,
+      ErrorThreshold:         0.8,
+      RequestVolumeThreshold: 10,
     })
 
     for _, tc := range cases {
       circuit.metrics = mockMetricsCollector{
         tc.requests,
         tc.errors,
+        0,
       }
 
       broken := circuit.isBroken()
@@ -107,10 +113,235 @@ func Test_isBroken(t *testing.T) {
   })
 }
 
+func Test_State_Transitions(t *testing.T) {
+  Convey("circuit state machine", t, func() {
+    ConfigureCircuit("state test", Settings{
+      ErrorThreshold:           0.5,
+      RequestVolumeThreshold:   1,
+      SleepDuration:            time.Hour,
+      HalfOpenMaxCalls:         2,
+      HalfOpenSuccessThreshold: 2,
+    })
+    resetCircuit("state test")
+    circuit := getCircuit("state test")
+
+    circuit.reportEvent(event{rootEvent: failure})
+
+    allowed := circuit.AllowRequest()
+    state := circuit.State()
+
+    Convey("failed requests open circuit", func() {
+      So(allowed, ShouldBeFalse)
+      So(state, ShouldEqual, Open)
+    })
+
+    Convey("after sleep duration", func() {
+      atomic.StoreInt64(&circuit.lastTested, 0)
+
+      allowed1, probe1 := circuit.allowRequest()
+      allowed2, probe2 := circuit.allowRequest()
+      allowed3, _ := circuit.allowRequest()
+
+      Convey("limited number of probes is allowed in half open state", func() {
+        So(circuit.State(), ShouldEqual, HalfOpen)
+        So(allowed1 && probe1, ShouldBeTrue)
+        So(allowed2 && probe2, ShouldBeTrue)
+        So(allowed3, ShouldBeFalse)
+      })
+
+      Convey("successful probes close circuit", func() {
+        circuit.reportEvent(event{rootEvent: success, probe: true})
+        state1 := circuit.State()
+
+        circuit.reportEvent(event{rootEvent: success, probe: true})
+        state2 := circuit.State()
+
+        So(state1, ShouldEqual, HalfOpen)
+        So(state2, ShouldEqual, Closed)
+        So(circuit.metrics.Errors().Sum(time.Now()), ShouldEqual, 0)
+        So(circuit.AllowRequest(), ShouldBeTrue)
+      })
+
+      Convey("failed probe opens circuit", func() {
+        circuit.reportEvent(event{rootEvent: success, probe: true})
+        circuit.reportEvent(event{rootEvent: timeout, probe: true})
+
+        So(circuit.State(), ShouldEqual, Open)
+        So(circuit.AllowRequest(), ShouldBeFalse)
+      })
+
+      Convey("rejected probe frees its slot", func() {
+        circuit.reportEvent(event{rootEvent: rejected, probe: true})
+        allowed, probe := circuit.allowRequest()
+
+        So(circuit.State(), ShouldEqual, HalfOpen)
+        So(allowed && probe, ShouldBeTrue)
+      })
+    })
+  })
+}
+
+func Test_isBroken_SlowCalls(t *testing.T) {
+  Convey("circuit isBroken test with slow calls", t, func() {
+    type TestCase struct {
+      requests  int64
+      errors    int64
+      slowCalls int64
+      broken    bool
+    }
+
+    cases := []TestCase{
+      {10, 0, 0, false},
+      {10, 0, 5, false},
+      {10, 0, 6, true},
+      {10, 1, 6, true},
+      {5, 0, 5, false},
+    }
+
+    circuit := getCircuit("broken test2")
+    ConfigureCircuit(circuit.name, Settings{
+      ErrorThreshold:         0.8,
+      RequestVolumeThreshold: 10,
+      SlowCallRateThreshold:  0.6,
+    })
+
+    for _, tc := range cases {
+      circuit.metrics = mockMetricsCollector{
+        tc.requests,
+        tc.errors,
+        tc.slowCalls,
+      }
+
+      broken := circuit.isBroken()
+
+      Convey(fmt.Sprintf("circuit with %d requests, %d errors and %d slow calls is broken? %t",
+        tc.requests, tc.errors, tc.slowCalls, tc.broken), func() {
+        So(broken, ShouldEqual, tc.broken)
+      })
+    }
+  })
+}
+
+func Test_isSlow(t *testing.T) {
+  Convey("classify calls by latency", t, func() {
+    settings := Settings{
+      Timeout:          time.Second,
+      SlowCallDuration: time.Millisecond * 100,
+    }
+
+    Convey("calls shorter than slow call duration are not slow", func() {
+      So(isSlow(event{rootEvent: success, executed: true, executionLatency: time.Millisecond * 99}, settings), ShouldBeFalse)
+    })
+
+    Convey("successful and failed calls can be slow", func() {
+      So(isSlow(event{rootEvent: success, executed: true, executionLatency: time.Millisecond * 100}, settings), ShouldBeTrue)
+      So(isSlow(event{rootEvent: failure, executed: true, executionLatency: time.Millisecond * 200}, settings), ShouldBeTrue)
+    })
+
+    Convey("timeouts are slow", func() {
+      So(isSlow(event{rootEvent: timeout}, settings), ShouldBeTrue)
+    })
+
+    Convey("rejected calls are not slow", func() {
+      So(isSlow(event{rootEvent: rejected}, settings), ShouldBeFalse)
+    })
+  })
+}
+
+func Test_CountWindow(t *testing.T) {
+  Convey("circuit with count based window", t, func() {
+    registry := NewRegistry()
+    circuit := registry.NewCircuit("count window", Settings{
+      ErrorThreshold:         0.5,
+      RequestVolumeThreshold: 4,
+      MetricsWindowType:      CountWindow,
+      MetricsWindowCalls:     4,
+    })
+
+    // old failures are pushed out of window by successful calls
+    circuit.reportEvent(event{rootEvent: failure})
+    circuit.reportEvent(event{rootEvent: failure})
+    circuit.reportEvent(event{rootEvent: success})
+    circuit.reportEvent(event{rootEvent: success})
+    circuit.reportEvent(event{rootEvent: success})
+    allowed1 := circuit.AllowRequest()
+
+    circuit.reportEvent(event{rootEvent: failure})
+    circuit.reportEvent(event{rootEvent: failure})
+    allowed2 := circuit.AllowRequest()
+
+    Convey("error ratio is evaluated over last calls", func() {
+      So(allowed1, ShouldBeTrue)
+      So(allowed2, ShouldBeFalse)
+      So(circuit.State(), ShouldEqual, Open)
+    })
+
+    Convey("changing window recreates metrics", func() {
+      settings := circuit.Settings()
+      settings.MetricsWindowType = TimeWindow
+      circuit.Configure(settings)
+
+      So(circuit.Metrics().Requests().Sum(time.Now()), ShouldEqual, 0)
+    })
+  })
+
+  Convey("count window smaller than request volume threshold", t, func() {
+    registry := NewRegistry()
+    circuit := registry.NewCircuit("small count window", Settings{
+      ErrorThreshold:         0.5,
+      RequestVolumeThreshold: 20,
+      MetricsWindowType:      CountWindow,
+      MetricsWindowCalls:     4,
+    })
+
+    for i := 0; i < 4; i++ {
+      circuit.reportEvent(event{rootEvent: failure})
+    }
+    allowed := circuit.AllowRequest()
+
+    Convey("threshold is capped at window size", func() {
+      So(allowed, ShouldBeFalse)
+      So(circuit.State(), ShouldEqual, Open)
+    })
+  })
+}
+
+func Test_State_SleepDuration(t *testing.T) {
+  Convey("open circuit with fake clock", t, func() {
+    start := time.Unix(1000, 0)
+    clock := fake.NewClock(start)
+    circuit := NewRegistryWithClock(clock).NewCircuit("sleep", Settings{
+      RequestVolumeThreshold: 1,
+      SleepDuration:          time.Minute,
+    })
+
+    circuit.reportEvent(event{rootEvent: failure})
+    circuit.AllowRequest()
+    opened := circuit.LastTested()
+
+    clock.Advance(time.Minute)
+    allowed1 := circuit.AllowRequest()
+
+    clock.Advance(time.Nanosecond)
+    allowed2 := circuit.AllowRequest()
+
+    Convey("circuit is opened at clock time", func() {
+      So(opened, ShouldEqual, start)
+    })
+
+    Convey("circuit is probed after sleep duration", func() {
+      So(allowed1, ShouldBeFalse)
+      So(allowed2, ShouldBeTrue)
+      So(circuit.State(), ShouldEqual, HalfOpen)
+    })
+  })
+}
+
 // mocks
 type mockMetricsCollector struct {
-  requestSum int64
-  errorSum   int64
+  requestSum  int64
+  errorSum    int64
+  slowCallSum int64
 }
 
 func (mock mockMetricsCollector) Requests() metrics.Number {
@@ -133,6 +364,14 @@ func (mock mockMetricsCollector) Cancelled() metrics.Number {
   panic("implement me")
 }
 
+func (mock mockMetricsCollector) ShortCircuited() metrics.Number {
+  panic("implement me")
+}
+
+func (mock mockMetricsCollector) SlowCalls() metrics.Number {
+  return mockNumber{mock.slowCallSum}
+}
+
 func (mock mockMetricsCollector) FallbackSuccess() metrics.Number {
   panic("implement me")
 }
@@ -141,6 +380,34 @@ func (mock mockMetricsCollector) FallbackFailure() metrics.Number {
   panic("implement me")
 }
 
+func (mock mockMetricsCollector) ExecutionLatency() metrics.Distribution {
+  panic("implement me")
+}
+
+func (mock mockMetricsCollector) TotalLatency() metrics.Distribution {
+  panic("implement me")
+}
+
+func (mock mockMetricsCollector) QueueWait() metrics.Distribution {
+  panic("implement me")
+}
+
+func (mock mockMetricsCollector) Snapshot(time.Time) metrics.Snapshot {
+  return metrics.Snapshot{
+    Requests:  mock.requestSum,
+    Errors:    mock.errorSum,
+    SlowCalls: mock.slowCallSum,
+  }
+}
+
+func (mock mockMetricsCollector) Counters(now time.Time) metrics.Snapshot {
+  return mock.Snapshot(now)
+}
+
+func (mockMetricsCollector) Update(update func(now time.Time)) {
+  update(time.Now())
+}
+
 func (mockMetricsCollector) Reset() {
   fmt.Println("reseting")
 }
@@ -157,6 +424,10 @@ func (mockNumber) Add(value int64) {
   panic("implement me")
 }
 
+func (mockNumber) AddAt(now time.Time, value int64) {
+  panic("implement me")
+}
+
 func (mockNumber) GetValue() int64 {
   panic("implement me")
 }
@@ -0,0 +1,42 @@
+package clock
+
+import "time"
+
+// source of time for metrics, circuits and executor
+// real clock is used unless other is given, see fake package for tests
+type Clock interface {
+  Now() time.Time
+  NewTimer(d time.Duration) Timer
+}
+
+type Timer interface {
+  C() <-chan time.Time
+  Stop() bool
+}
+
+type realClock struct{}
+
+type realTimer struct {
+  timer *time.Timer
+}
+
+// clock backed by time package
+func Real() Clock {
+  return realClock{}
+}
+
+func (realClock) Now() time.Time {
+  return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+  return realTimer{time.NewTimer(d)}
+}
+
+func (t realTimer) C() <-chan time.Time {
+  return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+  return t.timer.Stop()
+}
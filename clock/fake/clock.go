@@ -0,0 +1,118 @@
+package fake
+
+import (
+  "sync"
+  "time"
+  "breaker/clock"
+)
+
+// clock which moves only when advanced
+// timers fire when clock is advanced past their deadline
+type Clock struct {
+  mutex  sync.Mutex
+  cond   *sync.Cond
+  now    time.Time
+  timers []*timer
+}
+
+type timer struct {
+  clock    *Clock
+  deadline time.Time
+  c        chan time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+  c := &Clock{now: now}
+  c.cond = sync.NewCond(&c.mutex)
+
+  return c
+}
+
+func (c *Clock) Now() time.Time {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  return c.now
+}
+
+func (c *Clock) NewTimer(d time.Duration) clock.Timer {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  t := &timer{
+    clock:    c,
+    deadline: c.now.Add(d),
+    c:        make(chan time.Time, 1),
+  }
+
+  if d <= 0 {
+    t.c <- c.now
+    return t
+  }
+
+  c.timers = append(c.timers, t)
+  c.cond.Broadcast()
+
+  return t
+}
+
+// moves clock forward and fires expired timers
+func (c *Clock) Advance(d time.Duration) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  c.now = c.now.Add(d)
+
+  active := c.timers[:0]
+  for _, t := range c.timers {
+    if t.deadline.After(c.now) {
+      active = append(active, t)
+    } else {
+      t.c <- c.now
+    }
+  }
+
+  c.timers = active
+  c.cond.Broadcast()
+}
+
+// waits until at least n timers are waiting to fire
+// lets test advance clock after code under test started its timer
+func (c *Clock) BlockUntil(n int) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  for len(c.timers) < n {
+    c.cond.Wait()
+  }
+}
+
+// number of timers waiting to fire
+func (c *Clock) Timers() int {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  return len(c.timers)
+}
+
+func (t *timer) C() <-chan time.Time {
+  return t.c
+}
+
+// returns false if timer already fired or was stopped
+func (t *timer) Stop() bool {
+  c := t.clock
+
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  for i, active := range c.timers {
+    if active == t {
+      c.timers = append(c.timers[:i], c.timers[i+1:]...)
+      c.cond.Broadcast()
+      return true
+    }
+  }
+
+  return false
+}
@@ -0,0 +1,53 @@
+package fake
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+)
+
+func Test_Clock(t *testing.T) {
+  Convey("advance fake clock", t, func() {
+    start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+    clock := NewClock(start)
+
+    short := clock.NewTimer(time.Second)
+    long := clock.NewTimer(time.Minute)
+    stopped := clock.NewTimer(time.Second)
+    stoppedActive := stopped.Stop()
+
+    clock.Advance(2 * time.Second)
+
+    Convey("time is moved", func() {
+      So(clock.Now(), ShouldEqual, start.Add(2*time.Second))
+    })
+
+    Convey("expired timer fires", func() {
+      So(len(short.C()), ShouldEqual, 1)
+      So(<-short.C(), ShouldEqual, start.Add(2*time.Second))
+      So(short.Stop(), ShouldBeFalse)
+    })
+
+    Convey("other timers don't fire", func() {
+      So(len(long.C()), ShouldEqual, 0)
+      So(len(stopped.C()), ShouldEqual, 0)
+      So(stoppedActive, ShouldBeTrue)
+      So(clock.Timers(), ShouldEqual, 1)
+    })
+  })
+
+  Convey("wait for timer", t, func() {
+    clock := NewClock(time.Now())
+
+    go func() {
+      time.Sleep(time.Millisecond)
+      clock.NewTimer(time.Second)
+    }()
+
+    clock.BlockUntil(1)
+
+    Convey("timer is started", func() {
+      So(clock.Timers(), ShouldEqual, 1)
+    })
+  })
+}
@@ -0,0 +1,300 @@
+package breaker
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+  "gopkg.in/yaml.v2"
+)
+
+// settings file with default section and per circuit overrides
+// yaml example:
+//   default:
+//     timeout: 250ms
+//     maxConcurrentCalls: 100
+//   circuits:
+//     payments:
+//       timeout: 1s
+//       errorThreshold: 0.5
+type config struct {
+  Default  fileSettings            `json:"default" yaml:"default"`
+  Circuits map[string]fileSettings `json:"circuits" yaml:"circuits"`
+}
+
+// settings as written in file - durations are strings like 250ms
+type fileSettings struct {
+  Timeout            string  `json:"timeout" yaml:"timeout"`
+  MaxConcurrentCalls int     `json:"maxConcurrentCalls" yaml:"maxConcurrentCalls"`
+  ErrorThreshold     float32 `json:"errorThreshold" yaml:"errorThreshold"`
+  SleepDuration      string  `json:"sleepDuration" yaml:"sleepDuration"`
+
+  RequestVolumeThreshold int64 `json:"requestVolumeThreshold" yaml:"requestVolumeThreshold"`
+
+  SlowCallDuration      string  `json:"slowCallDuration" yaml:"slowCallDuration"`
+  SlowCallRateThreshold float32 `json:"slowCallRateThreshold" yaml:"slowCallRateThreshold"`
+
+  MetricsWindowType  string `json:"metricsWindowType" yaml:"metricsWindowType"` // time or count
+  MetricsWindowCalls int    `json:"metricsWindowCalls" yaml:"metricsWindowCalls"`
+  MetricsWindow      string `json:"metricsWindow" yaml:"metricsWindow"`
+  MetricsBuckets     int    `json:"metricsBuckets" yaml:"metricsBuckets"`
+
+  HalfOpenMaxCalls         int `json:"halfOpenMaxCalls" yaml:"halfOpenMaxCalls"`
+  HalfOpenSuccessThreshold int `json:"halfOpenSuccessThreshold" yaml:"halfOpenSuccessThreshold"`
+
+  HoldAbandonedTickets bool `json:"holdAbandonedTickets" yaml:"holdAbandonedTickets"`
+
+  MaxQueueSize int    `json:"maxQueueSize" yaml:"maxQueueSize"`
+  MaxQueueWait string `json:"maxQueueWait" yaml:"maxQueueWait"`
+
+  Isolation     string `json:"isolation" yaml:"isolation"` // goroutine or pool
+  PoolWorkers   int    `json:"poolWorkers" yaml:"poolWorkers"`
+  PoolQueueSize int    `json:"poolQueueSize" yaml:"poolQueueSize"`
+  PoolGroup     string `json:"poolGroup" yaml:"poolGroup"`
+
+  LimiterType        string `json:"limiterType" yaml:"limiterType"` // fixed, aimd or gradient
+  MinConcurrentCalls int    `json:"minConcurrentCalls" yaml:"minConcurrentCalls"`
+}
+
+func LoadConfig(path string) error {
+  return defaultRegistry.LoadConfig(path)
+}
+
+func WatchConfig(path string, interval time.Duration, onError func(error)) (stop func(), err error) {
+  return defaultRegistry.WatchConfig(path, interval, onError)
+}
+
+// configures registry defaults and circuits from yaml or json file
+// circuits removed from file since its last load are reset to defaults
+// settings are replaced at once so calls never see mix of old and new file, nothing is applied if file is invalid
+func (r *Registry) LoadConfig(path string) error {
+  config, err := readConfig(path)
+  if err != nil {
+    return err
+  }
+
+  defaults, err := config.Default.settings()
+  if err != nil {
+    return fmt.Errorf("%s: default: %s", path, err)
+  }
+
+  circuits := make(map[string]Settings, len(config.Circuits))
+
+  for name, fs := range config.Circuits {
+    if circuits[name], err = fs.settings(); err != nil {
+      return fmt.Errorf("%s: circuit %s: %s", path, name, err)
+    }
+  }
+
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  r.settingsMutex.Lock()
+  err = r.applyConfig(withDefaults(defaults, packageDefaults()), circuits)
+  r.settingsMutex.Unlock()
+
+  if err != nil {
+    return fmt.Errorf("%s: %s", path, err)
+  }
+
+  for name, circuit := range r.circuits {
+    circuit.applySettings(r.GetSettings(name))
+  }
+
+  return nil
+}
+
+// loads config and reloads it when file is modified
+// file is checked every interval, reload errors are passed to onError
+func (r *Registry) WatchConfig(path string, interval time.Duration, onError func(error)) (stop func(), err error) {
+  modified, err := modTime(path)
+  if err != nil {
+    return nil, err
+  }
+
+  if err := r.LoadConfig(path); err != nil {
+    return nil, err
+  }
+
+  done := make(chan struct{})
+  ticker := time.NewTicker(interval)
+
+  go func() {
+    defer ticker.Stop()
+
+    for {
+      select {
+      case <-done:
+        return
+      case <-ticker.C:
+        current, err := modTime(path)
+
+        if err == nil && current.Equal(modified) {
+          continue
+        }
+
+        if err == nil {
+          modified = current
+          err = r.LoadConfig(path)
+        }
+
+        if err != nil && onError != nil {
+          onError(err)
+        }
+      }
+    }
+  }()
+
+  return func() { close(done) }, nil
+}
+
+// replaces defaults and circuits of previous file, old settings are kept if new ones are invalid
+// must be called with settings mutex locked
+func (r *Registry) applyConfig(defaults Settings, circuits map[string]Settings) error {
+  if err := applyOverrides(defaults, r.envDefaults).validate(); err != nil {
+    return fmt.Errorf("default: %s", err)
+  }
+
+  oldDefaults := r.defaults
+  oldSettings := make(map[string]Settings, len(r.settings))
+  for name, s := range r.settings {
+    oldSettings[name] = s
+  }
+
+  r.defaults = defaults
+
+  for name := range r.fileCircuits {
+    if _, ok := circuits[name]; !ok {
+      delete(r.settings, name)
+    }
+  }
+
+  for name, s := range circuits {
+    r.settings[name] = s
+  }
+
+  if err := r.validateDefaults(defaults); err != nil {
+    r.defaults = oldDefaults
+    r.settings = oldSettings
+    return err
+  }
+
+  r.fileCircuits = make(map[string]bool, len(circuits))
+  for name := range circuits {
+    r.fileCircuits[name] = true
+  }
+
+  return nil
+}
+
+func readConfig(path string) (config, error) {
+  var config config
+
+  data, err := ioutil.ReadFile(path)
+  if err != nil {
+    return config, err
+  }
+
+  switch strings.ToLower(filepath.Ext(path)) {
+  case ".json":
+    decoder := json.NewDecoder(bytes.NewReader(data))
+    decoder.DisallowUnknownFields()
+    err = decoder.Decode(&config)
+  default:
+    err = yaml.UnmarshalStrict(data, &config)
+  }
+
+  if err != nil {
+    return config, fmt.Errorf("%s: %s", path, err)
+  }
+
+  return config, nil
+}
+
+func modTime(path string) (time.Time, error) {
+  info, err := os.Stat(path)
+  if err != nil {
+    return time.Time{}, err
+  }
+
+  return info.ModTime(), nil
+}
+
+func (fs fileSettings) settings() (Settings, error) {
+  s := Settings{
+    MaxConcurrentCalls:       fs.MaxConcurrentCalls,
+    ErrorThreshold:           fs.ErrorThreshold,
+    RequestVolumeThreshold:   fs.RequestVolumeThreshold,
+    SlowCallRateThreshold:    fs.SlowCallRateThreshold,
+    MetricsWindowCalls:       fs.MetricsWindowCalls,
+    MetricsBuckets:           fs.MetricsBuckets,
+    HalfOpenMaxCalls:         fs.HalfOpenMaxCalls,
+    HalfOpenSuccessThreshold: fs.HalfOpenSuccessThreshold,
+    HoldAbandonedTickets:     fs.HoldAbandonedTickets,
+    MaxQueueSize:             fs.MaxQueueSize,
+    PoolWorkers:              fs.PoolWorkers,
+    PoolQueueSize:            fs.PoolQueueSize,
+    PoolGroup:                fs.PoolGroup,
+    MinConcurrentCalls:       fs.MinConcurrentCalls,
+  }
+
+  var err error
+
+  if s.Timeout, err = parseDuration("timeout", fs.Timeout); err != nil {
+    return s, err
+  }
+
+  if s.SleepDuration, err = parseDuration("sleepDuration", fs.SleepDuration); err != nil {
+    return s, err
+  }
+
+  if s.SlowCallDuration, err = parseDuration("slowCallDuration", fs.SlowCallDuration); err != nil {
+    return s, err
+  }
+
+  if s.MaxQueueWait, err = parseDuration("maxQueueWait", fs.MaxQueueWait); err != nil {
+    return s, err
+  }
+
+  if s.MetricsWindow, err = parseDuration("metricsWindow", fs.MetricsWindow); err != nil {
+    return s, err
+  }
+
+  if fs.MetricsWindowType != "" {
+    if s.MetricsWindowType, err = parseWindowType(fs.MetricsWindowType); err != nil {
+      return s, fmt.Errorf("invalid metricsWindowType: %s", err)
+    }
+  }
+
+  if fs.Isolation != "" {
+    if s.Isolation, err = parseIsolation(fs.Isolation); err != nil {
+      return s, fmt.Errorf("invalid isolation: %s", err)
+    }
+  }
+
+  if fs.LimiterType != "" {
+    if s.LimiterType, err = parseLimiterType(fs.LimiterType); err != nil {
+      return s, fmt.Errorf("invalid limiter type: %s", err)
+    }
+  }
+
+  return s, nil
+}
+
+// empty value means default
+func parseDuration(field string, value string) (time.Duration, error) {
+  if value == "" {
+    return 0, nil
+  }
+
+  duration, err := time.ParseDuration(value)
+  if err != nil {
+    return 0, fmt.Errorf("invalid %s: %s", field, err)
+  }
+
+  return duration, nil
+}
@@ -0,0 +1,216 @@
+package breaker
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "time"
+)
+
+const yamlConfig = `
+default:
+  timeout: 250ms
+  maxConcurrentCalls: 100
+circuits:
+  payments:
+    timeout: 1s
+    errorThreshold: 0.5
+    sleepDuration: 5s
+`
+
+const jsonConfig = `{
+  "default": {"errorThreshold": 0.2},
+  "circuits": {"payments": {"maxConcurrentCalls": 10}}
+}`
+
+func Test_LoadConfig(t *testing.T) {
+  Convey("load yaml config", t, func() {
+    registry := NewRegistry()
+    existing := registry.Circuit("existing")
+
+    err := registry.LoadConfig(writeConfig(t, "breaker.yaml", yamlConfig))
+
+    Convey("config is loaded", func() {
+      So(err, ShouldBeNil)
+    })
+
+    Convey("default section is used for circuits without own settings", func() {
+      s := registry.GetSettings("other")
+      So(s.Timeout, ShouldEqual, time.Millisecond*250)
+      So(s.MaxConcurrentCalls, ShouldEqual, 100)
+      So(s.ErrorThreshold, ShouldEqual, DefaultErrorThreshold)
+      So(existing.limiter.Size(), ShouldEqual, 100)
+    })
+
+    Convey("circuit section overrides default section", func() {
+      s := registry.GetSettings("payments")
+      So(s.Timeout, ShouldEqual, time.Second)
+      So(s.MaxConcurrentCalls, ShouldEqual, 100)
+      So(s.ErrorThreshold, ShouldEqual, 0.5)
+      So(s.SleepDuration, ShouldEqual, time.Second*5)
+    })
+  })
+
+  Convey("load json config", t, func() {
+    registry := NewRegistry()
+    err := registry.LoadConfig(writeConfig(t, "breaker.json", jsonConfig))
+
+    Convey("config is loaded", func() {
+      So(err, ShouldBeNil)
+      So(registry.GetSettings("payments").MaxConcurrentCalls, ShouldEqual, 10)
+      So(registry.GetSettings("payments").ErrorThreshold, ShouldEqual, 0.2)
+    })
+  })
+
+  Convey("load invalid config", t, func() {
+    registry := NewRegistry()
+    err := registry.LoadConfig(writeConfig(t, "breaker.yaml", `
+default:
+  timeout: 250ms
+circuits:
+  payments:
+    timeout: soon
+`))
+
+    Convey("error is returned and nothing is applied", func() {
+      So(err, ShouldNotBeNil)
+      So(registry.GetSettings("other").Timeout, ShouldEqual, DefaultTimeout)
+    })
+  })
+}
+
+func Test_LoadConfig_MetricsWindow(t *testing.T) {
+  Convey("load config with metrics window", t, func() {
+    registry := NewRegistry()
+    err := registry.LoadConfig(writeConfig(t, "breaker.yaml", `
+default:
+  metricsWindow: 20s
+circuits:
+  payments:
+    metricsBuckets: 5
+  orders:
+    metricsBuckets: 3
+`))
+
+    Convey("window not divisible into buckets is rejected", func() {
+      So(err, ShouldNotBeNil)
+      So(err.Error(), ShouldContainSubstring, "orders")
+      So(registry.GetSettings("payments").MetricsWindow, ShouldEqual, DefaultMetricsWindow)
+    })
+  })
+}
+
+func Test_LoadConfig_Reload(t *testing.T) {
+  Convey("reload config without circuit", t, func() {
+    registry := NewRegistry()
+    registry.ConfigureCircuit("orders", Settings{Timeout: time.Second * 3})
+    path := writeConfig(t, "breaker.yaml", yamlConfig)
+
+    err1 := registry.LoadConfig(path)
+    timeout1 := registry.GetSettings("payments").Timeout
+
+    err2 := registry.LoadConfig(writeConfig(t, "breaker.yaml", "default:\n  timeout: 500ms\n"))
+
+    Convey("removed circuit is reset to defaults", func() {
+      So(err1, ShouldBeNil)
+      So(err2, ShouldBeNil)
+      So(timeout1, ShouldEqual, time.Second)
+      So(registry.GetSettings("payments").Timeout, ShouldEqual, time.Millisecond*500)
+    })
+
+    Convey("circuit configured outside of file is kept", func() {
+      So(registry.GetSettings("orders").Timeout, ShouldEqual, time.Second*3)
+    })
+  })
+
+  Convey("load config invalid for circuit configured outside of file", t, func() {
+    registry := NewRegistry()
+    registry.ConfigureDefaults(Settings{MetricsWindow: time.Second * 9})
+    registry.ConfigureCircuit("orders", Settings{MetricsBuckets: 3})
+
+    // default window can't be split into buckets of orders
+    err := registry.LoadConfig(writeConfig(t, "breaker.yaml", `
+default:
+  metricsWindow: 10s
+circuits:
+  payments:
+    timeout: 2s
+`))
+
+    Convey("error is returned and nothing is applied", func() {
+      So(err, ShouldNotBeNil)
+      So(err.Error(), ShouldContainSubstring, "orders")
+      So(registry.GetSettings("payments").Timeout, ShouldEqual, DefaultTimeout)
+      So(registry.GetSettings("orders").MetricsWindow, ShouldEqual, time.Second*9)
+    })
+  })
+}
+
+func Test_WatchConfig(t *testing.T) {
+  Convey("watch config file", t, func() {
+    registry := NewRegistry()
+    path := writeConfig(t, "breaker.yml", yamlConfig)
+
+    errors := make(chan error, 10)
+    stop, err := registry.WatchConfig(path, time.Millisecond*10, func(err error) {
+      errors <- err
+    })
+    So(err, ShouldBeNil)
+    defer stop()
+
+    timeout1 := registry.GetSettings("payments").Timeout
+
+    updateConfig(path, "circuits:\n  payments:\n    timeout: 2s\n")
+    timeout2 := waitForTimeout(registry, "payments", time.Second*2)
+
+    updateConfig(path, "circuits: [")
+    var reloadErr error
+    select {
+    case reloadErr = <-errors:
+    case <-time.After(time.Second):
+    }
+
+    Convey("changes are applied", func() {
+      So(timeout1, ShouldEqual, time.Second)
+      So(timeout2, ShouldEqual, time.Second*2)
+    })
+
+    Convey("invalid changes are reported and ignored", func() {
+      So(reloadErr, ShouldNotBeNil)
+      So(registry.GetSettings("payments").Timeout, ShouldEqual, time.Second*2)
+    })
+  })
+}
+
+func writeConfig(t *testing.T, name string, content string) string {
+  path := filepath.Join(t.TempDir(), name)
+
+  if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  return path
+}
+
+// rewrite file making sure modification time changes
+func updateConfig(path string, content string) {
+  info, _ := os.Stat(path)
+  ioutil.WriteFile(path, []byte(content), 0644)
+  os.Chtimes(path, time.Now(), info.ModTime().Add(time.Second))
+}
+
+func waitForTimeout(registry *Registry, name string, expected time.Duration) time.Duration {
+  deadline := time.Now().Add(time.Second)
+
+  for time.Now().Before(deadline) {
+    if timeout := registry.GetSettings(name).Timeout; timeout == expected {
+      return timeout
+    }
+
+    time.Sleep(time.Millisecond * 10)
+  }
+
+  return registry.GetSettings(name).Timeout
+}
@@ -0,0 +1,84 @@
+package breaker
+
+// how circuit state is decided
+type Mode int
+
+const (
+  // state is changed by error and slow call rates
+  Automatic Mode = iota
+  // all calls are short circuited
+  ForcedOpen
+  // all calls are allowed
+  ForcedClosed
+)
+
+func (mode Mode) String() string {
+  switch mode {
+  case Automatic:
+    return "automatic"
+  case ForcedOpen:
+    return "forced open"
+  case ForcedClosed:
+    return "forced closed"
+  }
+
+  return "unknown"
+}
+
+func ForceOpen(name string) {
+  getCircuit(name).ForceOpen()
+}
+
+func ForceClose(name string) {
+  getCircuit(name).ForceClose()
+}
+
+func AutomaticMode(name string) {
+  getCircuit(name).AutomaticMode()
+}
+
+func ResetMetrics(name string) {
+  getCircuit(name).ResetMetrics()
+}
+
+// opens circuit and keeps it open until other mode is set
+func (circuit *Circuit) ForceOpen() {
+  circuit.setMode(ForcedOpen, Open)
+}
+
+// closes circuit and keeps it closed until other mode is set
+func (circuit *Circuit) ForceClose() {
+  circuit.setMode(ForcedClosed, Closed)
+}
+
+// returns circuit to state decided by metrics
+// circuit stays in its current state, forced open circuit is probed after sleep duration
+func (circuit *Circuit) AutomaticMode() {
+  circuit.stateMutex.Lock()
+  defer circuit.stateMutex.Unlock()
+
+  circuit.mode = Automatic
+}
+
+func (circuit *Circuit) Mode() Mode {
+  circuit.stateMutex.Lock()
+  defer circuit.stateMutex.Unlock()
+
+  return circuit.mode
+}
+
+// forgets calls recorded in rolling window
+func (circuit *Circuit) ResetMetrics() {
+  circuit.Metrics().Reset()
+}
+
+func (circuit *Circuit) setMode(mode Mode, state State) {
+  circuit.stateMutex.Lock()
+  defer circuit.stateMutex.Unlock()
+
+  circuit.mode = mode
+
+  if circuit.state != state {
+    circuit.setState(state)
+  }
+}
@@ -0,0 +1,83 @@
+package breaker
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+  "sync/atomic"
+  "context"
+  "breaker/errors"
+)
+
+func Test_ForceOpen(t *testing.T) {
+  Convey("force open healthy circuit", t, func() {
+    name := "Test_ForceOpen"
+    resetCircuit(name)
+
+    ForceOpen(name)
+
+    executed := false
+    err := Do(name, context.Background(), func(ctx context.Context) error {
+      executed = true
+      return nil
+    }, nil)
+
+    circuit := getCircuit(name)
+    atomic.StoreInt64(&circuit.lastTested, 0)
+    allowed := circuit.AllowRequest()
+
+    Convey("calls are short circuited", func() {
+      So(executed, ShouldBeFalse)
+      So(err, ShouldEqual, errors.CircuitBrokenError)
+      So(circuit.Metrics().ShortCircuited().Sum(time.Now()), ShouldEqual, 1)
+    })
+
+    Convey("circuit is not probed", func() {
+      So(allowed, ShouldBeFalse)
+      So(circuit.State(), ShouldEqual, Open)
+      So(circuit.Mode(), ShouldEqual, ForcedOpen)
+    })
+
+    Convey("circuit is probed in automatic mode", func() {
+      AutomaticMode(name)
+      So(circuit.AllowRequest(), ShouldBeTrue)
+      So(circuit.State(), ShouldEqual, HalfOpen)
+    })
+  })
+}
+
+func Test_ForceClose(t *testing.T) {
+  Convey("force close failing circuit", t, func() {
+    registry := NewRegistry()
+    circuit := registry.NewCircuit("force close", Settings{
+      RequestVolumeThreshold: 1,
+      SleepDuration:          time.Hour,
+    })
+
+    circuit.reportEvent(event{rootEvent: failure})
+    opened := !circuit.AllowRequest()
+
+    circuit.ForceClose()
+    circuit.reportEvent(event{rootEvent: failure})
+
+    Convey("calls are allowed despite errors", func() {
+      So(opened, ShouldBeTrue)
+      So(circuit.AllowRequest(), ShouldBeTrue)
+      So(circuit.State(), ShouldEqual, Closed)
+      So(circuit.Mode(), ShouldEqual, ForcedClosed)
+    })
+
+    Convey("circuit is opened by errors in automatic mode", func() {
+      circuit.AutomaticMode()
+      So(circuit.AllowRequest(), ShouldBeFalse)
+      So(circuit.State(), ShouldEqual, Open)
+    })
+
+    Convey("reset metrics forget errors", func() {
+      circuit.ResetMetrics()
+      circuit.AutomaticMode()
+      So(circuit.AllowRequest(), ShouldBeTrue)
+      So(circuit.Metrics().Requests().Sum(time.Now()), ShouldEqual, 0)
+    })
+  })
+}
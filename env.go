@@ -0,0 +1,264 @@
+package breaker
+
+import (
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// environment variables overriding settings
+//   BREAKER_<NAME>_<FIELD> - settings of named circuit, e.g. BREAKER_PAYMENTS_API_TIMEOUT=250ms
+//   BREAKER_DEFAULT_<FIELD> - registry defaults, e.g. BREAKER_DEFAULT_ERROR_THRESHOLD=0.5
+// circuit name is upper cased with all characters except letters and digits replaced by _
+//
+// precedence from highest, whatever order settings and environment are loaded in:
+//   BREAKER_<NAME>_<FIELD>, ConfigureCircuit, BREAKER_DEFAULT_<FIELD>, ConfigureDefaults, package defaults
+const (
+  envPrefix      = "BREAKER_"
+  envDefaultName = "DEFAULT"
+)
+
+type settingOverride func(s *Settings)
+
+type envField struct {
+  name  string
+  parse func(value string) (settingOverride, error)
+}
+
+// longer names first - name of circuit may end with shorter field name
+var envFields = []envField{
+  {"HOLD_ABANDONED_TICKETS", boolField(func(s *Settings, v bool) { s.HoldAbandonedTickets = v })},
+  {"SLOW_CALL_RATE_THRESHOLD", floatField(func(s *Settings, v float32) { s.SlowCallRateThreshold = v })},
+  {"HALF_OPEN_SUCCESS_THRESHOLD", intField(func(s *Settings, v int64) { s.HalfOpenSuccessThreshold = int(v) })},
+  {"REQUEST_VOLUME_THRESHOLD", intField(func(s *Settings, v int64) { s.RequestVolumeThreshold = v })},
+  {"METRICS_WINDOW_CALLS", intField(func(s *Settings, v int64) { s.MetricsWindowCalls = int(v) })},
+  {"METRICS_WINDOW_TYPE", windowTypeField(func(s *Settings, v WindowType) { s.MetricsWindowType = v })},
+  {"METRICS_BUCKETS", intField(func(s *Settings, v int64) { s.MetricsBuckets = int(v) })},
+  {"METRICS_WINDOW", durationField(func(s *Settings, v time.Duration) { s.MetricsWindow = v })},
+  {"POOL_QUEUE_SIZE", intField(func(s *Settings, v int64) { s.PoolQueueSize = int(v) })},
+  {"POOL_WORKERS", intField(func(s *Settings, v int64) { s.PoolWorkers = int(v) })},
+  {"POOL_GROUP", stringField(func(s *Settings, v string) { s.PoolGroup = v })},
+  {"ISOLATION", isolationField(func(s *Settings, v Isolation) { s.Isolation = v })},
+  {"MAX_QUEUE_SIZE", intField(func(s *Settings, v int64) { s.MaxQueueSize = int(v) })},
+  {"MAX_QUEUE_WAIT", durationField(func(s *Settings, v time.Duration) { s.MaxQueueWait = v })},
+  {"MIN_CONCURRENT_CALLS", intField(func(s *Settings, v int64) { s.MinConcurrentCalls = int(v) })},
+  {"LIMITER_TYPE", limiterTypeField(func(s *Settings, v LimiterType) { s.LimiterType = v })},
+  {"MAX_CONCURRENT_CALLS", intField(func(s *Settings, v int64) { s.MaxConcurrentCalls = int(v) })},
+  {"HALF_OPEN_MAX_CALLS", intField(func(s *Settings, v int64) { s.HalfOpenMaxCalls = int(v) })},
+  {"ERROR_THRESHOLD", floatField(func(s *Settings, v float32) { s.ErrorThreshold = v })},
+  {"SLOW_CALL_DURATION", durationField(func(s *Settings, v time.Duration) { s.SlowCallDuration = v })},
+  {"SLEEP_DURATION", durationField(func(s *Settings, v time.Duration) { s.SleepDuration = v })},
+  {"TIMEOUT", durationField(func(s *Settings, v time.Duration) { s.Timeout = v })},
+}
+
+func LoadEnv() error {
+  return defaultRegistry.LoadEnv(os.Environ())
+}
+
+// replaces environment overrides with ones parsed from environ (KEY=value list)
+// nothing is applied if any BREAKER_ variable is invalid
+func (r *Registry) LoadEnv(environ []string) error {
+  defaults := []settingOverride{}
+  circuits := map[string][]settingOverride{}
+
+  var errs []string
+
+  for _, variable := range environ {
+    key, value, _ := strings.Cut(variable, "=")
+
+    if !strings.HasPrefix(key, envPrefix) {
+      continue
+    }
+
+    name, override, err := parseEnv(strings.TrimPrefix(key, envPrefix), value)
+    if err != nil {
+      errs = append(errs, fmt.Sprintf("%s: %s", key, err))
+      continue
+    }
+
+    if name == envDefaultName {
+      defaults = append(defaults, override)
+    } else {
+      circuits[name] = append(circuits[name], override)
+    }
+  }
+
+  if len(errs) > 0 {
+    return fmt.Errorf("invalid environment: %s", strings.Join(errs, "; "))
+  }
+
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  r.settingsMutex.Lock()
+  err := r.validateEnv(defaults, circuits)
+  if err == nil {
+    r.envDefaults = defaults
+    r.envCircuits = circuits
+  }
+  r.settingsMutex.Unlock()
+
+  if err != nil {
+    return fmt.Errorf("invalid environment: %s", err)
+  }
+
+  for name, circuit := range r.circuits {
+    circuit.applySettings(r.GetSettings(name))
+  }
+
+  return nil
+}
+
+// checks settings circuits would get with environment overrides
+// must be called with settings mutex locked
+func (r *Registry) validateEnv(defaults []settingOverride, circuits map[string][]settingOverride) error {
+  base := applyOverrides(r.defaults, defaults)
+  if err := base.validate(); err != nil {
+    return fmt.Errorf("%s%s: %s", envPrefix, envDefaultName, err)
+  }
+
+  configured := map[string]bool{}
+
+  for name, s := range r.settings {
+    configured[envName(name)] = true
+
+    if err := applyOverrides(withDefaults(s, base), circuits[envName(name)]).validate(); err != nil {
+      return fmt.Errorf("%s%s: %s", envPrefix, envName(name), err)
+    }
+  }
+
+  // circuits without own settings use defaults
+  for name, overrides := range circuits {
+    if configured[name] {
+      continue
+    }
+
+    if err := applyOverrides(base, overrides).validate(); err != nil {
+      return fmt.Errorf("%s%s: %s", envPrefix, name, err)
+    }
+  }
+
+  return nil
+}
+
+func parseEnv(key string, value string) (string, settingOverride, error) {
+  for _, field := range envFields {
+    name := strings.TrimSuffix(key, "_"+field.name)
+
+    if name == key || name == "" {
+      continue
+    }
+
+    override, err := field.parse(value)
+    return name, override, err
+  }
+
+  return "", nil, fmt.Errorf("unknown setting")
+}
+
+// circuit name as used in environment variable
+func envName(name string) string {
+  return strings.Map(func(r rune) rune {
+    switch {
+    case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+      return r
+    case r >= 'a' && r <= 'z':
+      return r - 'a' + 'A'
+    }
+
+    return '_'
+  }, name)
+}
+
+func applyOverrides(s Settings, overrides []settingOverride) Settings {
+  for _, override := range overrides {
+    override(&s)
+  }
+
+  return s
+}
+
+func durationField(set func(s *Settings, v time.Duration)) func(string) (settingOverride, error) {
+  return func(value string) (settingOverride, error) {
+    v, err := time.ParseDuration(value)
+    if err != nil {
+      return nil, err
+    }
+
+    return func(s *Settings) { set(s, v) }, nil
+  }
+}
+
+func intField(set func(s *Settings, v int64)) func(string) (settingOverride, error) {
+  return func(value string) (settingOverride, error) {
+    v, err := strconv.ParseInt(value, 10, 64)
+    if err != nil {
+      return nil, err
+    }
+
+    return func(s *Settings) { set(s, v) }, nil
+  }
+}
+
+func floatField(set func(s *Settings, v float32)) func(string) (settingOverride, error) {
+  return func(value string) (settingOverride, error) {
+    v, err := strconv.ParseFloat(value, 32)
+    if err != nil {
+      return nil, err
+    }
+
+    return func(s *Settings) { set(s, float32(v)) }, nil
+  }
+}
+
+func boolField(set func(s *Settings, v bool)) func(string) (settingOverride, error) {
+  return func(value string) (settingOverride, error) {
+    v, err := strconv.ParseBool(value)
+    if err != nil {
+      return nil, err
+    }
+
+    return func(s *Settings) { set(s, v) }, nil
+  }
+}
+
+func windowTypeField(set func(s *Settings, v WindowType)) func(string) (settingOverride, error) {
+  return func(value string) (settingOverride, error) {
+    v, err := parseWindowType(strings.ToLower(value))
+    if err != nil {
+      return nil, err
+    }
+
+    return func(s *Settings) { set(s, v) }, nil
+  }
+}
+
+func stringField(set func(s *Settings, v string)) func(string) (settingOverride, error) {
+  return func(value string) (settingOverride, error) {
+    return func(s *Settings) { set(s, value) }, nil
+  }
+}
+
+func isolationField(set func(s *Settings, v Isolation)) func(string) (settingOverride, error) {
+  return func(value string) (settingOverride, error) {
+    v, err := parseIsolation(strings.ToLower(value))
+    if err != nil {
+      return nil, err
+    }
+
+    return func(s *Settings) { set(s, v) }, nil
+  }
+}
+
+func limiterTypeField(set func(s *Settings, v LimiterType)) func(string) (settingOverride, error) {
+  return func(value string) (settingOverride, error) {
+    v, err := parseLimiterType(strings.ToLower(value))
+    if err != nil {
+      return nil, err
+    }
+
+    return func(s *Settings) { set(s, v) }, nil
+  }
+}
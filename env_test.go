@@ -0,0 +1,108 @@
+package breaker
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+)
+
+func Test_LoadEnv(t *testing.T) {
+  Convey("load environment overrides", t, func() {
+    registry := NewRegistry()
+    registry.ConfigureCircuit("payments-api", Settings{
+      Timeout:        time.Second * 3,
+      ErrorThreshold: 0.3,
+    })
+    existing := registry.Circuit("payments-api")
+
+    err := registry.LoadEnv([]string{
+      "PATH=/bin",
+      "BREAKER_PAYMENTS_API_TIMEOUT=250ms",
+      "BREAKER_PAYMENTS_API_MAX_CONCURRENT_CALLS=7",
+      "BREAKER_PAYMENTS_API_HOLD_ABANDONED_TICKETS=true",
+      "BREAKER_PAYMENTS_API_ISOLATION=pool",
+      "BREAKER_PAYMENTS_API_POOL_WORKERS=3",
+      "BREAKER_DEFAULT_ERROR_THRESHOLD=0.5",
+      "BREAKER_DEFAULT_SLEEP_DURATION=10s",
+    })
+
+    Convey("environment is loaded", func() {
+      So(err, ShouldBeNil)
+    })
+
+    Convey("circuit variables override configured settings", func() {
+      s := registry.GetSettings("payments-api")
+      So(s.Timeout, ShouldEqual, time.Millisecond*250)
+      So(s.MaxConcurrentCalls, ShouldEqual, 7)
+      So(s.ErrorThreshold, ShouldEqual, 0.3)
+      So(s.HoldAbandonedTickets, ShouldBeTrue)
+      So(s.Isolation, ShouldEqual, PoolIsolation)
+      So(s.PoolWorkers, ShouldEqual, 3)
+      So(existing.limiter.Size(), ShouldEqual, 7)
+    })
+
+    Convey("default variables override defaults", func() {
+      s := registry.GetSettings("other")
+      So(s.ErrorThreshold, ShouldEqual, 0.5)
+      So(s.SleepDuration, ShouldEqual, time.Second*10)
+      So(s.Timeout, ShouldEqual, DefaultTimeout)
+    })
+
+    Convey("default variables fill settings configured later", func() {
+      s := registry.ConfigureCircuit("later", Settings{ErrorThreshold: 0.1})
+      So(s.ErrorThreshold, ShouldEqual, 0.1)
+      So(s.SleepDuration, ShouldEqual, time.Second*10)
+    })
+  })
+
+  Convey("load environment after circuit is configured", t, func() {
+    registry := NewRegistry()
+    registry.ConfigureCircuit("x", Settings{ErrorThreshold: 0.1})
+
+    err := registry.LoadEnv([]string{"BREAKER_DEFAULT_TIMEOUT=250ms"})
+    registry.ConfigureDefaults(Settings{SleepDuration: time.Minute})
+
+    Convey("default variables and defaults fill zero fields of configured circuit", func() {
+      s := registry.GetSettings("x")
+      So(err, ShouldBeNil)
+      So(s.Timeout, ShouldEqual, time.Millisecond*250)
+      So(s.SleepDuration, ShouldEqual, time.Minute)
+      So(s.ErrorThreshold, ShouldEqual, 0.1)
+    })
+  })
+
+  Convey("load invalid environment", t, func() {
+    registry := NewRegistry()
+
+    err := registry.LoadEnv([]string{
+      "BREAKER_PAYMENTS_TIMEOUT=soon",
+      "BREAKER_PAYMENTS_COLOR=red",
+      "BREAKER_ORDERS_MAX_CONCURRENT_CALLS=5",
+    })
+
+    Convey("all errors are reported", func() {
+      So(err, ShouldNotBeNil)
+      So(err.Error(), ShouldContainSubstring, "BREAKER_PAYMENTS_TIMEOUT")
+      So(err.Error(), ShouldContainSubstring, "BREAKER_PAYMENTS_COLOR")
+    })
+
+    Convey("nothing is applied", func() {
+      So(registry.GetSettings("orders").MaxConcurrentCalls, ShouldEqual, DefaultMaxConcurrentCalls)
+    })
+  })
+
+  Convey("load environment with window not divisible into buckets", t, func() {
+    registry := NewRegistry()
+    registry.ConfigureCircuit("orders", Settings{MetricsWindow: 9 * time.Second, MetricsBuckets: 3})
+
+    err := registry.LoadEnv([]string{
+      "BREAKER_ORDERS_METRICS_WINDOW=10s",
+    })
+
+    Convey("error is returned and nothing is applied", func() {
+      So(err, ShouldNotBeNil)
+      So(err.Error(), ShouldContainSubstring, "BREAKER_ORDERS")
+      So(registry.GetSettings("orders").MetricsWindow, ShouldEqual, 9*time.Second)
+    })
+  })
+}
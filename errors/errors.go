@@ -7,4 +7,5 @@ var (
   TimeoutError         = fmt.Errorf("timeout")
   CircuitBrokenError   = fmt.Errorf("circuit is broken")
   CancelledError       = fmt.Errorf("cancelled")
+  PoolRejectedError    = fmt.Errorf("worker pool is full")
 )
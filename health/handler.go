@@ -0,0 +1,160 @@
+package health
+
+import (
+  "encoding/json"
+  "net/http"
+  "time"
+  "breaker"
+  "breaker/metrics"
+  bsync "breaker/sync"
+)
+
+// http handler listing registry circuits as json
+// responds with 503 if some critical circuit is degraded so it can be used as readiness probe,
+// circuit is degraded if it is not closed by itself - forced modes are set on purpose and ignored
+type Handler struct {
+  registry *breaker.Registry
+  critical map[string]bool // nil if all circuits are critical
+}
+
+// handler with all circuits critical
+func NewHandler(registry *breaker.Registry) *Handler {
+  return &Handler{registry: registry}
+}
+
+// handler degraded only by named circuits, other circuits are listed but don't affect response code
+func NewHandlerWithCritical(registry *breaker.Registry, critical ...string) *Handler {
+  h := &Handler{registry: registry, critical: map[string]bool{}}
+
+  for _, name := range critical {
+    h.critical[name] = true
+  }
+
+  return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  status := h.status(h.registry.Clock().Now())
+
+  code := http.StatusOK
+  if status.Degraded {
+    code = http.StatusServiceUnavailable
+  }
+
+  w.Header().Set("Content-Type", "application/json")
+  w.Header().Set("Cache-Control", "no-cache")
+  w.WriteHeader(code)
+
+  json.NewEncoder(w).Encode(status)
+}
+
+func (h *Handler) status(now time.Time) status {
+  status := status{Circuits: []circuitStatus{}}
+
+  for _, circuit := range h.registry.Circuits() {
+    state := circuit.State()
+    status.Degraded = status.Degraded || h.degrades(circuit, state)
+
+    status.Circuits = append(status.Circuits, circuitStatusOf(circuit, state, now))
+  }
+
+  return status
+}
+
+func (h *Handler) degrades(circuit *breaker.Circuit, state breaker.State) bool {
+  if h.critical != nil && !h.critical[circuit.Name()] {
+    return false
+  }
+
+  return state != breaker.Closed && circuit.Mode() == breaker.Automatic
+}
+
+func circuitStatusOf(circuit *breaker.Circuit, state breaker.State, now time.Time) circuitStatus {
+  settings := circuit.Settings()
+  snapshot := circuit.Metrics().Snapshot(now)
+
+  var lastTested *time.Time
+  if t := circuit.LastTested(); !t.IsZero() {
+    lastTested = &t
+  }
+
+  return circuitStatus{
+    Name:            circuit.Name(),
+    State:           state.String(),
+    Mode:            circuit.Mode().String(),
+    Settings:        settingsStatusOf(settings),
+    Metrics:         metricsStatusOf(snapshot),
+    ErrorPercentage: errorPercentage(snapshot),
+    Limiter: limiterStatus{
+      Capacity: settings.MaxConcurrentCalls,
+      Limit:    circuit.ConcurrencyLimit(),
+      Free:     circuit.Limiter().Size(),
+      Queued:   circuit.Queued(),
+    },
+    Pool:       poolStatusOf(circuit.WorkerPool()),
+    Abandoned:  circuit.Abandoned(),
+    LastTested: lastTested,
+  }
+}
+
+func settingsStatusOf(s breaker.Settings) settingsStatus {
+  return settingsStatus{
+    Timeout:                  s.Timeout.String(),
+    MaxConcurrentCalls:       s.MaxConcurrentCalls,
+    ErrorThreshold:           s.ErrorThreshold,
+    SleepDuration:            s.SleepDuration.String(),
+    RequestVolumeThreshold:   s.RequestVolumeThreshold,
+    SlowCallDuration:         s.SlowCallDuration.String(),
+    SlowCallRateThreshold:    s.SlowCallRateThreshold,
+    MetricsWindowType:        s.MetricsWindowType.String(),
+    MetricsWindowCalls:       s.MetricsWindowCalls,
+    MetricsWindow:            s.MetricsWindow.String(),
+    MetricsBuckets:           s.MetricsBuckets,
+    HalfOpenMaxCalls:         s.HalfOpenMaxCalls,
+    HalfOpenSuccessThreshold: s.HalfOpenSuccessThreshold,
+    HoldAbandonedTickets:     s.HoldAbandonedTickets,
+    MaxQueueSize:             s.MaxQueueSize,
+    MaxQueueWait:             s.MaxQueueWait.String(),
+    Isolation:                s.Isolation.String(),
+    PoolWorkers:              s.PoolWorkers,
+    PoolQueueSize:            s.PoolQueueSize,
+    PoolGroup:                s.PoolGroup,
+    LimiterType:              s.LimiterType.String(),
+    MinConcurrentCalls:       s.MinConcurrentCalls,
+  }
+}
+
+func poolStatusOf(pool *bsync.WorkerPool) *poolStatus {
+  if pool == nil {
+    return nil
+  }
+
+  return &poolStatus{
+    Workers:   pool.Workers(),
+    QueueSize: pool.QueueSize(),
+    Active:    pool.Active(),
+    Queued:    pool.Queued(),
+  }
+}
+
+func metricsStatusOf(s metrics.Snapshot) metricsStatus {
+  return metricsStatus{
+    Requests:        s.Requests,
+    Errors:          s.Errors,
+    Rejects:         s.Rejects,
+    Timeouts:        s.Timeouts,
+    Cancelled:       s.Cancelled,
+    ShortCircuited:  s.ShortCircuited,
+    SlowCalls:       s.SlowCalls,
+    FallbackSuccess: s.FallbackSuccess,
+    FallbackFailure: s.FallbackFailure,
+  }
+}
+
+func errorPercentage(s metrics.Snapshot) float64 {
+  if s.Requests == 0 {
+    return 0
+  }
+
+  return float64(s.Errors) * 100 / float64(s.Requests)
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "context"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "breaker"
+)
+
+func Test_Handler(t *testing.T) {
+  Convey("list circuits of healthy registry", t, func() {
+    registry := breaker.NewRegistry()
+    circuit := registry.NewCircuit("payments", breaker.Settings{MaxConcurrentCalls: 5})
+
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      return nil
+    }, nil)
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      return fmt.Errorf("exec failure")
+    }, func(ctx context.Context, err error) error {
+      return nil
+    })
+
+    code, status := serve(NewHandler(registry))
+
+    Convey("registry is not degraded", func() {
+      So(code, ShouldEqual, http.StatusOK)
+      So(status["degraded"], ShouldEqual, false)
+    })
+
+    Convey("circuit is listed", func() {
+      circuits := status["circuits"].([]interface{})
+      So(len(circuits), ShouldEqual, 1)
+
+      payments := circuits[0].(map[string]interface{})
+      So(payments["name"], ShouldEqual, "payments")
+      So(payments["state"], ShouldEqual, "closed")
+      So(payments["mode"], ShouldEqual, "automatic")
+      So(payments["errorPercentage"], ShouldEqual, 50)
+      So(payments["lastTested"], ShouldBeNil)
+      So(payments["settings"].(map[string]interface{})["timeout"], ShouldEqual, "1s")
+      So(payments["metrics"].(map[string]interface{})["requests"], ShouldEqual, 2)
+      So(payments["metrics"].(map[string]interface{})["fallbackSuccess"], ShouldEqual, 1)
+      So(payments["limiter"].(map[string]interface{})["capacity"], ShouldEqual, 5)
+      So(payments["limiter"].(map[string]interface{})["free"], ShouldEqual, 5)
+    })
+  })
+
+  Convey("list circuits of registry with open circuit", t, func() {
+    registry := breaker.NewRegistry()
+    registry.NewCircuit("orders", breaker.Settings{})
+    circuit := registry.NewCircuit("payments", breaker.Settings{RequestVolumeThreshold: 1})
+
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      return fmt.Errorf("exec failure")
+    }, nil)
+    circuit.AllowRequest()
+
+    code, status := serve(NewHandler(registry))
+
+    Convey("registry is degraded", func() {
+      So(code, ShouldEqual, http.StatusServiceUnavailable)
+      So(status["degraded"], ShouldEqual, true)
+    })
+
+    Convey("circuits are listed by name", func() {
+      circuits := status["circuits"].([]interface{})
+      So(len(circuits), ShouldEqual, 2)
+
+      orders := circuits[0].(map[string]interface{})
+      So(orders["name"], ShouldEqual, "orders")
+      So(orders["state"], ShouldEqual, "closed")
+
+      payments := circuits[1].(map[string]interface{})
+      So(payments["name"], ShouldEqual, "payments")
+      So(payments["state"], ShouldEqual, "open")
+      So(payments["lastTested"], ShouldNotBeNil)
+    })
+
+    Convey("registry is ready if open circuit is not critical", func() {
+      code, status := serve(NewHandlerWithCritical(registry, "orders"))
+      So(code, ShouldEqual, http.StatusOK)
+      So(status["degraded"], ShouldEqual, false)
+    })
+
+    Convey("registry is degraded if open circuit is critical", func() {
+      code, _ := serve(NewHandlerWithCritical(registry, "orders", "payments"))
+      So(code, ShouldEqual, http.StatusServiceUnavailable)
+    })
+  })
+
+  Convey("list circuits of registry with forced open circuit", t, func() {
+    registry := breaker.NewRegistry()
+    registry.NewCircuit("payments", breaker.Settings{}).ForceOpen()
+
+    code, status := serve(NewHandler(registry))
+
+    Convey("forced mode doesn't degrade registry", func() {
+      So(code, ShouldEqual, http.StatusOK)
+      So(status["degraded"], ShouldEqual, false)
+    })
+  })
+}
+
+// calls handler and returns response code and parsed body
+func serve(handler http.Handler) (int, map[string]interface{}) {
+  request := httptest.NewRequest("GET", "/circuits", nil)
+  recorder := httptest.NewRecorder()
+  handler.ServeHTTP(recorder, request)
+
+  status := map[string]interface{}{}
+  json.Unmarshal(recorder.Body.Bytes(), &status)
+
+  return recorder.Code, status
+}
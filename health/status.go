@@ -0,0 +1,84 @@
+package health
+
+import "time"
+
+// response of /circuits endpoint
+type status struct {
+  // some critical circuit is not closed in automatic mode
+  Degraded bool            `json:"degraded"`
+  Circuits []circuitStatus `json:"circuits"`
+}
+
+type circuitStatus struct {
+  Name            string         `json:"name"`
+  State           string         `json:"state"`
+  Mode            string         `json:"mode"`
+  Settings        settingsStatus `json:"settings"`
+  Metrics         metricsStatus  `json:"metrics"`
+  ErrorPercentage float64        `json:"errorPercentage"`
+  Limiter         limiterStatus  `json:"limiter"`
+  Pool            *poolStatus    `json:"pool"` // null if circuit doesn't use worker pool
+  Abandoned       int64          `json:"abandoned"` // execs running after their calls returned
+  LastTested      *time.Time     `json:"lastTested"` // null if circuit was never opened
+}
+
+// settings with durations written same way as in config file
+type settingsStatus struct {
+  Timeout            string  `json:"timeout"`
+  MaxConcurrentCalls int     `json:"maxConcurrentCalls"`
+  ErrorThreshold     float32 `json:"errorThreshold"`
+  SleepDuration      string  `json:"sleepDuration"`
+
+  RequestVolumeThreshold int64 `json:"requestVolumeThreshold"`
+
+  SlowCallDuration      string  `json:"slowCallDuration"`
+  SlowCallRateThreshold float32 `json:"slowCallRateThreshold"`
+
+  MetricsWindowType  string `json:"metricsWindowType"`
+  MetricsWindowCalls int    `json:"metricsWindowCalls"`
+  MetricsWindow      string `json:"metricsWindow"`
+  MetricsBuckets     int    `json:"metricsBuckets"`
+
+  HalfOpenMaxCalls         int `json:"halfOpenMaxCalls"`
+  HalfOpenSuccessThreshold int `json:"halfOpenSuccessThreshold"`
+
+  HoldAbandonedTickets bool `json:"holdAbandonedTickets"`
+
+  MaxQueueSize int    `json:"maxQueueSize"`
+  MaxQueueWait string `json:"maxQueueWait"`
+
+  Isolation     string `json:"isolation"`
+  PoolWorkers   int    `json:"poolWorkers"`
+  PoolQueueSize int    `json:"poolQueueSize"`
+  PoolGroup     string `json:"poolGroup"`
+
+  LimiterType        string `json:"limiterType"`
+  MinConcurrentCalls int    `json:"minConcurrentCalls"`
+}
+
+// rolling counters
+type metricsStatus struct {
+  Requests        int64 `json:"requests"`
+  Errors          int64 `json:"errors"`
+  Rejects         int64 `json:"rejects"`
+  Timeouts        int64 `json:"timeouts"`
+  Cancelled       int64 `json:"cancelled"`
+  ShortCircuited  int64 `json:"shortCircuited"`
+  SlowCalls       int64 `json:"slowCalls"`
+  FallbackSuccess int64 `json:"fallbackSuccess"`
+  FallbackFailure int64 `json:"fallbackFailure"`
+}
+
+type limiterStatus struct {
+  Capacity int   `json:"capacity"`
+  Limit    int   `json:"limit"` // current limit of adaptive limiter
+  Free     int   `json:"free"`
+  Queued   int64 `json:"queued"` // calls waiting for ticket
+}
+
+type poolStatus struct {
+  Workers   int   `json:"workers"`
+  QueueSize int   `json:"queueSize"`
+  Active    int   `json:"active"` // workers running exec
+  Queued    int   `json:"queued"` // execs waiting for worker
+}
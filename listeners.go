@@ -0,0 +1,137 @@
+package breaker
+
+import (
+  "breaker/metrics"
+  "time"
+  "fmt"
+)
+
+// circuit state transition
+type StateChange struct {
+  Name    string
+  From    State
+  To      State
+  Metrics metrics.Snapshot // rolling metrics at the moment of transition
+}
+
+// called on circuit state transition
+// listeners are called outside of request path by goroutine of the circuit,
+// in order of transitions - blocked listener delays later notifications of its circuit
+// but never circuit calls. listener registered for all circuits is called concurrently
+// for different circuits and must be safe for concurrent use
+type StateListener func(change StateChange)
+
+// called with recovered panic of state listener - listener panic never stops circuit
+type ListenerErrorHandler func(change StateChange, err error)
+
+// finished call of circuit
+type Execution struct {
+  Name      string
+  Event     ExecutionEvent // success, failure, timeout, rejected, short circuited or cancelled
+  Fallback  ExecutionEvent // fallback success or fallback failure, empty if fallback was not called
+  Slow      bool           // counted as slow call
+  Latency   time.Duration  // from call start to result including fallback
+  QueueWait time.Duration  // time waited for limiter ticket, 0 if call was not queued
+}
+
+// called synchronously when circuit call is finished - must be fast
+type ExecutionListener func(execution Execution)
+
+// register listener for state changes of named circuit
+func OnStateChange(name string, listener StateListener) {
+  defaultRegistry.OnStateChange(name, listener)
+}
+
+// register listener for state changes of all circuits
+// listener is called concurrently for different circuits
+func OnAnyStateChange(listener StateListener) {
+  defaultRegistry.OnAnyStateChange(listener)
+}
+
+// register listener for finished calls of all circuits
+func OnExecution(listener ExecutionListener) {
+  defaultRegistry.OnExecution(listener)
+}
+
+// register handler of state listener panics
+func OnListenerError(handler ListenerErrorHandler) {
+  defaultRegistry.OnListenerError(handler)
+}
+
+func (r *Registry) OnStateChange(name string, listener StateListener) {
+  r.listenersMutex.Lock()
+  defer r.listenersMutex.Unlock()
+
+  r.listeners[name] = append(r.listeners[name], listener)
+}
+
+func (r *Registry) OnAnyStateChange(listener StateListener) {
+  r.listenersMutex.Lock()
+  defer r.listenersMutex.Unlock()
+
+  r.globalListeners = append(r.globalListeners, listener)
+}
+
+func (r *Registry) OnExecution(listener ExecutionListener) {
+  r.listenersMutex.Lock()
+  defer r.listenersMutex.Unlock()
+
+  r.executionListeners = append(r.executionListeners, listener)
+}
+
+func (r *Registry) OnListenerError(handler ListenerErrorHandler) {
+  r.listenersMutex.Lock()
+  defer r.listenersMutex.Unlock()
+
+  r.listenerErrorHandlers = append(r.listenerErrorHandlers, handler)
+}
+
+func (r *Registry) notifyExecution(execution Execution) {
+  r.listenersMutex.RLock()
+  listeners := r.executionListeners
+  r.listenersMutex.RUnlock()
+
+  for _, listener := range listeners {
+    listener(execution)
+  }
+}
+
+func (r *Registry) notifyListeners(change StateChange) {
+  r.listenersMutex.RLock()
+  named := r.listeners[change.Name]
+  global := r.globalListeners
+  handlers := r.listenerErrorHandlers
+  r.listenersMutex.RUnlock()
+
+  for _, listener := range named {
+    callListener(listener, change, handlers)
+  }
+
+  for _, listener := range global {
+    callListener(listener, change, handlers)
+  }
+}
+
+func callListener(listener StateListener, change StateChange, handlers []ListenerErrorHandler) {
+  // listener panic should not stop circuit goroutine
+  defer func() {
+    if panicErr := recover(); panicErr != nil {
+      err := fmt.Errorf("state listener panic: %v", panicErr)
+
+      for _, handler := range handlers {
+        callErrorHandler(handler, change, err)
+      }
+    }
+  }()
+
+  listener(change)
+}
+
+func callErrorHandler(handler ListenerErrorHandler, change StateChange, err error) {
+  // broken handler should not stop circuit goroutine either
+  defer func() {
+    recover()
+  }()
+
+  handler(change, err)
+}
@@ -0,0 +1,212 @@
+package breaker
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+  "sync/atomic"
+  "context"
+)
+
+func Test_StateListeners(t *testing.T) {
+  Convey("register state listeners", t, func() {
+    name := "listeners test"
+    ConfigureCircuit(name, Settings{
+      ErrorThreshold:         0.5,
+      RequestVolumeThreshold: 1,
+      SleepDuration:          time.Hour,
+    })
+    resetCircuit(name)
+
+    named := make(chan StateChange, 10)
+    global := make(chan StateChange, 10)
+
+    // listeners from previous runs stay registered - don't block on their channels
+    OnStateChange(name, func(change StateChange) {
+      sendChange(named, change)
+    })
+    OnStateChange("other circuit", func(change StateChange) {
+      panic("should not be called")
+    })
+    OnAnyStateChange(func(change StateChange) {
+      if change.Name == name {
+        sendChange(global, change)
+      }
+    })
+
+    circuit := getCircuit(name)
+    circuit.reportEvent(event{rootEvent: failure})
+    circuit.AllowRequest()
+
+    atomic.StoreInt64(&circuit.lastTested, 0)
+    circuit.AllowRequest()
+    circuit.reportEvent(event{rootEvent: success, probe: true})
+
+    Convey("listeners are notified about transitions", func() {
+      opened := receiveChange(named)
+      So(opened.From, ShouldEqual, Closed)
+      So(opened.To, ShouldEqual, Open)
+      So(opened.Metrics.Requests, ShouldEqual, 1)
+      So(opened.Metrics.Errors, ShouldEqual, 1)
+
+      halfOpened := receiveChange(named)
+      So(halfOpened.From, ShouldEqual, Open)
+      So(halfOpened.To, ShouldEqual, HalfOpen)
+
+      closed := receiveChange(named)
+      So(closed.From, ShouldEqual, HalfOpen)
+      So(closed.To, ShouldEqual, Closed)
+    })
+
+    Convey("global listeners are notified", func() {
+      So(receiveChange(global).To, ShouldEqual, Open)
+      So(receiveChange(global).To, ShouldEqual, HalfOpen)
+      So(receiveChange(global).To, ShouldEqual, Closed)
+    })
+  })
+}
+
+func Test_StateListeners_Blocking(t *testing.T) {
+  Convey("register blocking state listener", t, func() {
+    registry := NewRegistry()
+    circuit := registry.Circuit("blocking")
+
+    release := make(chan struct{})
+    registry.OnStateChange("blocking", func(change StateChange) {
+      <-release
+    })
+
+    done := make(chan bool, 1)
+    go func() {
+      // more transitions than any buffer would hold
+      for i := 0; i < 100; i++ {
+        circuit.ForceOpen()
+        circuit.ForceClose()
+      }
+      done <- true
+    }()
+
+    finished := false
+    select {
+    case finished = <-done:
+    case <-time.After(time.Second):
+    }
+
+    state := circuit.State()
+    close(release)
+
+    Convey("transitions don't wait for listener", func() {
+      So(finished, ShouldBeTrue)
+      So(state, ShouldEqual, Closed)
+    })
+  })
+
+  Convey("register listener changing state of its circuit", t, func() {
+    registry := NewRegistry()
+    circuit := registry.Circuit("reentrant")
+
+    closed := make(chan StateChange, 10)
+    registry.OnStateChange("reentrant", func(change StateChange) {
+      if change.To == Open {
+        circuit.ForceClose()
+      } else {
+        sendChange(closed, change)
+      }
+    })
+
+    circuit.ForceOpen()
+
+    Convey("listener is notified about its own transition", func() {
+      So(receiveChange(closed).To, ShouldEqual, Closed)
+    })
+  })
+
+  Convey("register panicking state listener", t, func() {
+    registry := NewRegistry()
+    circuit := registry.Circuit("panicking")
+
+    errs := make(chan error, 10)
+    registry.OnListenerError(func(change StateChange, err error) {
+      errs <- err
+    })
+    registry.OnListenerError(func(change StateChange, err error) {
+      panic("broken handler")
+    })
+
+    registry.OnStateChange("panicking", func(change StateChange) {
+      if change.To == Open {
+        panic("broken listener")
+      }
+    })
+
+    closed := make(chan StateChange, 10)
+    registry.OnAnyStateChange(func(change StateChange) {
+      sendChange(closed, change)
+    })
+
+    circuit.ForceOpen()
+    circuit.ForceClose()
+
+    Convey("panic is reported to error handler", func() {
+      var err error
+      select {
+      case err = <-errs:
+      case <-time.After(time.Second):
+      }
+
+      So(err, ShouldNotBeNil)
+      So(err.Error(), ShouldContainSubstring, "broken listener")
+    })
+
+    Convey("panic doesn't stop later notifications", func() {
+      So(receiveChange(closed).To, ShouldEqual, Open)
+      So(receiveChange(closed).To, ShouldEqual, Closed)
+    })
+  })
+}
+
+func receiveChange(changes chan StateChange) StateChange {
+  select {
+  case change := <-changes:
+    return change
+  case <-time.After(time.Second):
+    return StateChange{}
+  }
+}
+
+func sendChange(changes chan StateChange, change StateChange) {
+  select {
+  case changes <- change:
+  default:
+  }
+}
+
+func Test_ExecutionListeners(t *testing.T) {
+  Convey("register execution listener", t, func() {
+    registry := NewRegistry()
+
+    executions := make(chan Execution, 10)
+    registry.OnExecution(func(execution Execution) {
+      executions <- execution
+    })
+
+    registry.Do("executions", context.Background(), func(ctx context.Context) error {
+      time.Sleep(time.Millisecond * 10)
+      return nil
+    }, nil)
+
+    Convey("listener is called for finished call", func() {
+      So(len(executions), ShouldEqual, 1)
+
+      execution := <-executions
+      So(execution.Name, ShouldEqual, "executions")
+      So(execution.Event, ShouldEqual, SuccessEvent)
+      So(execution.Latency, ShouldBeGreaterThanOrEqualTo, time.Millisecond*10)
+    })
+
+    Convey("registry lists circuits", func() {
+      So(len(registry.Circuits()), ShouldEqual, 1)
+      So(registry.Circuits()[0].Name(), ShouldEqual, "executions")
+    })
+  })
+}
@@ -0,0 +1,220 @@
+package metrics
+
+import (
+  "sync"
+  "time"
+  "breaker/clock"
+)
+
+// counters of collector stored in call slots
+const (
+  requestsCounter = iota
+  errorsCounter
+  rejectsCounter
+  timeoutsCounter
+  cancelledCounter
+  shortCircuitedCounter
+  slowCallsCounter
+  fallbackSuccessCounter
+  fallbackFailureCounter
+  counters
+)
+
+// distributions of collector stored in call slots
+const (
+  executionLatencyDistribution = iota
+  totalLatencyDistribution
+  queueWaitDistribution
+  distributions
+)
+
+// window of last size calls
+// call is started by increment of requests or short circuited counter,
+// other counters and latencies are added to slot of current call
+type callWindow struct {
+  mutex sync.RWMutex
+  slots []callSlot
+  calls int
+}
+
+type callSlot struct {
+  values    [counters]int64
+  latencies [distributions]time.Duration
+  added     [distributions]bool // latency was added, e.g. exec finished
+}
+
+// number backed by call window slots
+type countNumber struct {
+  window  *callWindow
+  counter int
+}
+
+// distribution backed by call window slots
+type countDistribution struct {
+  window       *callWindow
+  distribution int
+}
+
+// create collector with counters for last size calls instead of time period
+func NewCountCollector(size int) Collector {
+  collector := &collector{
+    // counters of call must be added to the same slot
+    serialUpdates: true,
+    clock:         clock.Real(),
+    reset: func(c *collector) {
+      window := &callWindow{slots: make([]callSlot, size)}
+
+      c.requests = countNumber{window, requestsCounter}
+      c.errors = countNumber{window, errorsCounter}
+
+      c.rejects = countNumber{window, rejectsCounter}
+      c.timeouts = countNumber{window, timeoutsCounter}
+      c.cancelled = countNumber{window, cancelledCounter}
+
+      c.shortCircuited = countNumber{window, shortCircuitedCounter}
+      c.slowCalls = countNumber{window, slowCallsCounter}
+
+      c.fallbackSuccess = countNumber{window, fallbackSuccessCounter}
+      c.fallbackFailure = countNumber{window, fallbackFailureCounter}
+
+      c.executionLatency = countDistribution{window, executionLatencyDistribution}
+      c.totalLatency = countDistribution{window, totalLatencyDistribution}
+      c.queueWait = countDistribution{window, queueWaitDistribution}
+    },
+  }
+
+  collector.Reset()
+  return collector
+}
+
+// must be called with window mutex locked
+func (w *callWindow) current() *callSlot {
+  return &w.slots[(w.calls-1+len(w.slots))%len(w.slots)]
+}
+
+// must be called with window mutex locked
+func (w *callWindow) startCall() {
+  w.calls++
+  *w.current() = callSlot{}
+}
+
+// slots of recorded calls
+// must be called with window mutex locked
+func (w *callWindow) recorded() []callSlot {
+  if w.calls < len(w.slots) {
+    return w.slots[:w.calls]
+  }
+
+  return w.slots
+}
+
+func (number countNumber) Increment() {
+  number.Add(1)
+}
+
+func (number countNumber) Add(value int64) {
+  w := number.window
+
+  w.mutex.Lock()
+  defer w.mutex.Unlock()
+
+  if len(w.slots) == 0 {
+    return
+  }
+
+  if number.counter == requestsCounter || number.counter == shortCircuitedCounter || w.calls == 0 {
+    w.startCall()
+  }
+
+  w.current().values[number.counter] += value
+}
+
+// time is ignored
+func (number countNumber) AddAt(now time.Time, value int64) {
+  number.Add(value)
+}
+
+func (number countNumber) GetValue() int64 {
+  w := number.window
+
+  w.mutex.RLock()
+  defer w.mutex.RUnlock()
+
+  if len(w.slots) == 0 || w.calls == 0 {
+    return 0
+  }
+
+  return w.current().values[number.counter]
+}
+
+// sum over last calls - time is ignored
+func (number countNumber) Sum(time.Time) int64 {
+  w := number.window
+
+  w.mutex.RLock()
+  defer w.mutex.RUnlock()
+
+  var sum int64
+  for _, slot := range w.recorded() {
+    sum += slot.values[number.counter]
+  }
+
+  return sum
+}
+
+func (d countDistribution) Add(value time.Duration) {
+  w := d.window
+
+  w.mutex.Lock()
+  defer w.mutex.Unlock()
+
+  if len(w.slots) == 0 {
+    return
+  }
+
+  if w.calls == 0 {
+    w.startCall()
+  }
+
+  slot := w.current()
+  slot.latencies[d.distribution] = value
+  slot.added[d.distribution] = true
+}
+
+// time is ignored
+func (d countDistribution) AddAt(now time.Time, value time.Duration) {
+  d.Add(value)
+}
+
+func (d countDistribution) Percentile(p float64, now time.Time) time.Duration {
+  return percentileOf(d.samples(), p)
+}
+
+func (d countDistribution) Mean(now time.Time) time.Duration {
+  return meanOf(d.samples())
+}
+
+func (d countDistribution) Max(now time.Time) time.Duration {
+  return maxOf(d.samples())
+}
+
+func (d countDistribution) Snapshot(now time.Time) Latency {
+  return latencyOf(d.samples())
+}
+
+func (d countDistribution) samples() []time.Duration {
+  w := d.window
+
+  w.mutex.RLock()
+  defer w.mutex.RUnlock()
+
+  var samples []time.Duration
+
+  for _, slot := range w.recorded() {
+    if slot.added[d.distribution] {
+      samples = append(samples, slot.latencies[d.distribution])
+    }
+  }
+
+  return samples
+}
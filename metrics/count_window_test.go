@@ -0,0 +1,75 @@
+package metrics
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+)
+
+func Test_CountCollector(t *testing.T) {
+  Convey("record 7 calls in window of 5 calls", t, func() {
+    collector := NewCountCollector(5)
+
+    // 3 failed calls followed by 4 successful
+    for i := 0; i < 7; i++ {
+      collector.Requests().Increment()
+
+      if i < 3 {
+        collector.Errors().Increment()
+        collector.Timeouts().Increment()
+      } else {
+        collector.ExecutionLatency().Add(time.Duration(i) * time.Millisecond)
+      }
+
+      collector.TotalLatency().Add(time.Duration(i) * time.Millisecond)
+    }
+
+    now := time.Now()
+
+    Convey("only last 5 calls are counted", func() {
+      So(collector.Requests().Sum(now), ShouldEqual, 5)
+      So(collector.Errors().Sum(now), ShouldEqual, 1)
+      So(collector.Timeouts().Sum(now), ShouldEqual, 1)
+    })
+
+    Convey("value of last call is returned", func() {
+      So(collector.Requests().GetValue(), ShouldEqual, 1)
+      So(collector.Errors().GetValue(), ShouldEqual, 0)
+    })
+
+    Convey("latency of last 5 calls is used", func() {
+      So(collector.TotalLatency().Percentile(0, now), ShouldEqual, 2*time.Millisecond)
+      So(collector.TotalLatency().Max(now), ShouldEqual, 6*time.Millisecond)
+      So(collector.ExecutionLatency().Mean(now), ShouldEqual, 4500*time.Microsecond)
+    })
+
+    Convey("window is not expired by time", func() {
+      So(collector.Requests().Sum(now.Add(time.Hour)), ShouldEqual, 5)
+    })
+
+    Convey("reset clears window", func() {
+      collector.Reset()
+      So(collector.Requests().Sum(now), ShouldEqual, 0)
+      So(collector.TotalLatency().Max(now), ShouldEqual, 0)
+    })
+  })
+}
+
+func Test_CountCollector_ShortCircuited(t *testing.T) {
+  Convey("record short circuited calls", t, func() {
+    collector := NewCountCollector(3)
+
+    collector.Requests().Increment()
+    collector.Errors().Increment()
+    collector.ShortCircuited().Increment()
+    collector.FallbackSuccess().Increment()
+    collector.ShortCircuited().Increment()
+    collector.ShortCircuited().Increment()
+
+    Convey("short circuited calls take slots of window", func() {
+      So(collector.Requests().Sum(time.Now()), ShouldEqual, 0)
+      So(collector.ShortCircuited().Sum(time.Now()), ShouldEqual, 3)
+      So(collector.FallbackSuccess().Sum(time.Now()), ShouldEqual, 1)
+    })
+  })
+}
@@ -1,10 +1,9 @@
 package metrics
 
-import "time"
-
-const (
-  slots        = 10
-  slotDuration = time.Second
+import (
+  "sync"
+  "time"
+  "breaker/clock"
 )
 
 type Collector interface {
@@ -14,8 +13,20 @@ type Collector interface {
   Rejects() Number
   Timeouts() Number
   Cancelled() Number
+  ShortCircuited() Number
+  SlowCalls() Number
   FallbackSuccess() Number
   FallbackFailure() Number
+  ExecutionLatency() Distribution
+  TotalLatency() Distribution
+  QueueWait() Distribution
+
+  // counters and latency stats of window ending at now
+  // updates made by single Update call at its now are seen all or none
+  Snapshot(now time.Time) Snapshot
+  // counters of window ending at now without latency stats, cheap enough for every call
+  Counters(now time.Time) Snapshot
+  Update(update func(now time.Time))
 }
 
 type collector struct {
@@ -26,12 +37,72 @@ type collector struct {
   timeouts  Number
   cancelled Number
 
+  shortCircuited Number
+  slowCalls      Number
+
   fallbackSuccess Number
   fallbackFailure Number
+
+  executionLatency Distribution
+  totalLatency     Distribution
+  queueWait        Distribution
+
+  // updates share lock, snapshot and reset take it exclusively
+  mutex sync.RWMutex
+  // updates exclude each other
+  serialUpdates bool
+  // time of updates
+  clock clock.Clock
+
+  // creates counters and distributions
+  reset func(c *collector)
 }
 
-func NewCollector() Collector {
-  collector := &collector{}
+// point in time view of collector counters and latencies
+type Snapshot struct {
+  Requests        int64
+  Errors          int64
+  Rejects         int64
+  Timeouts        int64
+  Cancelled       int64
+  ShortCircuited  int64
+  SlowCalls       int64
+  FallbackSuccess int64
+  FallbackFailure int64
+
+  ExecutionLatency Latency
+  TotalLatency     Latency
+  QueueWait        Latency
+}
+
+// create collector with counters for time window split into buckets
+// for example 10s window and 10 buckets - each bucket holds data for 1s
+func NewCollector(window time.Duration, buckets uint, clock clock.Clock) Collector {
+  slots := buckets
+  slotDuration := window / time.Duration(buckets)
+
+  collector := &collector{
+    clock: clock,
+    reset: func(c *collector) {
+      c.requests = CreateNumber(slots, slotDuration, clock)
+      c.errors = CreateNumber(slots, slotDuration, clock)
+
+      c.rejects = CreateNumber(slots, slotDuration, clock)
+      c.timeouts = CreateNumber(slots, slotDuration, clock)
+      c.cancelled = CreateNumber(slots, slotDuration, clock)
+
+      c.shortCircuited = CreateNumber(slots, slotDuration, clock)
+      c.slowCalls = CreateNumber(slots, slotDuration, clock)
+
+      c.fallbackSuccess = CreateNumber(slots, slotDuration, clock)
+      c.fallbackFailure = CreateNumber(slots, slotDuration, clock)
+
+      c.executionLatency = CreateDistribution(slots, slotDuration, clock)
+      c.totalLatency = CreateDistribution(slots, slotDuration, clock)
+      c.queueWait = CreateDistribution(slots, slotDuration, clock)
+    },
+  }
+
   collector.Reset()
   return collector
 }
@@ -56,6 +127,15 @@ func (c *collector) Cancelled() Number {
   return c.cancelled
 }
 
+func (c *collector) ShortCircuited() Number {
+  return c.shortCircuited
+}
+
+// calls which took longer than slow call duration
+func (c *collector) SlowCalls() Number {
+  return c.slowCalls
+}
+
 func (c *collector) FallbackSuccess() Number {
   return c.fallbackSuccess
 }
@@ -64,14 +144,72 @@ func (c *collector) FallbackFailure() Number {
   return c.fallbackFailure
 }
 
-func (c *collector) Reset() {
-  c.requests = CreateNumber(slots, slotDuration)
-  c.errors = CreateNumber(slots, slotDuration)
+// latency of exec func calls
+func (c *collector) ExecutionLatency() Distribution {
+  return c.executionLatency
+}
+
+// latency of circuit calls including fallback
+func (c *collector) TotalLatency() Distribution {
+  return c.totalLatency
+}
+
+// time calls waited in queue for concurrent calls limiter ticket
+func (c *collector) QueueWait() Distribution {
+  return c.queueWait
+}
+
+func (c *collector) Snapshot(now time.Time) Snapshot {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  snapshot := c.counters(now)
+  snapshot.ExecutionLatency = c.executionLatency.Snapshot(now)
+  snapshot.TotalLatency = c.totalLatency.Snapshot(now)
+  snapshot.QueueWait = c.queueWait.Snapshot(now)
+
+  return snapshot
+}
 
-  c.rejects = CreateNumber(slots, slotDuration)
-  c.timeouts = CreateNumber(slots, slotDuration)
-  c.cancelled = CreateNumber(slots, slotDuration)
+func (c *collector) Counters(now time.Time) Snapshot {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  return c.counters(now)
+}
+
+// must be called with mutex locked
+func (c *collector) counters(now time.Time) Snapshot {
+  return Snapshot{
+    Requests:        c.requests.Sum(now),
+    Errors:          c.errors.Sum(now),
+    Rejects:         c.rejects.Sum(now),
+    Timeouts:        c.timeouts.Sum(now),
+    Cancelled:       c.cancelled.Sum(now),
+    ShortCircuited:  c.shortCircuited.Sum(now),
+    SlowCalls:       c.slowCalls.Sum(now),
+    FallbackSuccess: c.fallbackSuccess.Sum(now),
+    FallbackFailure: c.fallbackFailure.Sum(now),
+  }
+}
+
+// runs update of several counters, e.g. requests and errors of one call
+// counters are added at the same now so they land in the same bucket
+func (c *collector) Update(update func(now time.Time)) {
+  if c.serialUpdates {
+    c.mutex.Lock()
+    defer c.mutex.Unlock()
+  } else {
+    c.mutex.RLock()
+    defer c.mutex.RUnlock()
+  }
+
+  update(c.clock.Now())
+}
+
+func (c *collector) Reset() {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
 
-  c.fallbackSuccess = CreateNumber(slots, slotDuration)
-  c.fallbackFailure = CreateNumber(slots, slotDuration)
+  c.reset(c)
 }
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+  "sync"
+  "breaker/clock"
+  "breaker/clock/fake"
+)
+
+func Test_Snapshot(t *testing.T) {
+  Convey("record calls", t, func() {
+    collector := NewCollector(10*time.Second, 10, clock.Real())
+
+    for i := 1; i <= 4; i++ {
+      collector.Update(func(now time.Time) {
+        collector.Requests().Increment()
+        if i%2 == 0 {
+          collector.Errors().Increment()
+          collector.Timeouts().Increment()
+        }
+        collector.ExecutionLatency().Add(time.Duration(i) * time.Millisecond)
+        collector.TotalLatency().Add(time.Duration(i) * time.Millisecond)
+      })
+    }
+
+    snapshot := collector.Snapshot(time.Now())
+
+    Convey("counters are included", func() {
+      So(snapshot.Requests, ShouldEqual, 4)
+      So(snapshot.Errors, ShouldEqual, 2)
+      So(snapshot.Timeouts, ShouldEqual, 2)
+      So(snapshot.Rejects, ShouldEqual, 0)
+    })
+
+    Convey("latency stats are included", func() {
+      So(snapshot.ExecutionLatency.Count, ShouldEqual, 4)
+      So(snapshot.ExecutionLatency.Max, ShouldEqual, 4*time.Millisecond)
+      So(snapshot.TotalLatency.Mean, ShouldEqual, 2500*time.Microsecond)
+      So(snapshot.TotalLatency.P50, ShouldEqual, 2*time.Millisecond)
+      So(snapshot.TotalLatency.Min, ShouldEqual, time.Millisecond)
+      So(snapshot.TotalLatency.P75, ShouldEqual, 3*time.Millisecond)
+      So(snapshot.TotalLatency.P995, ShouldEqual, 4*time.Millisecond)
+    })
+
+    Convey("counters leave out latency stats", func() {
+      counters := collector.Counters(time.Now())
+      So(counters.Requests, ShouldEqual, 4)
+      So(counters.Errors, ShouldEqual, 2)
+      So(counters.ExecutionLatency.Count, ShouldEqual, 0)
+    })
+  })
+}
+
+func Test_Snapshot_Consistent(t *testing.T) {
+  collectors := map[string]Collector{
+    "time window":  NewCollector(10*time.Second, 10, clock.Real()),
+    "count window": NewCountCollector(50),
+  }
+
+  for name, collector := range collectors {
+    Convey("take snapshots while failed calls are recorded in "+name, t, func() {
+      wg := sync.WaitGroup{}
+      wg.Add(10)
+
+      for i := 0; i < 10; i++ {
+        go func() {
+          defer wg.Done()
+
+          for j := 0; j < 100; j++ {
+            collector.Update(func(now time.Time) {
+              collector.Requests().Increment()
+              collector.Errors().Increment()
+            })
+          }
+        }()
+      }
+
+      consistent := true
+
+      for i := 0; i < 100; i++ {
+        snapshot := collector.Snapshot(time.Now())
+        consistent = consistent && snapshot.Requests == snapshot.Errors
+
+        counters := collector.Counters(time.Now())
+        consistent = consistent && counters.Requests == counters.Errors
+      }
+
+      wg.Wait()
+
+      Convey("every snapshot sees all counters of call", func() {
+        So(consistent, ShouldBeTrue)
+      })
+    })
+  }
+}
+
+func Test_Snapshot_PeriodBoundary(t *testing.T) {
+  Convey("record call across period boundary", t, func() {
+    start := time.Unix(1000, 0)
+    clock := fake.NewClock(start)
+    collector := NewCollector(10*time.Second, 10, clock)
+
+    clock.Advance(900 * time.Millisecond)
+    collector.Update(func(now time.Time) {
+      collector.Requests().AddAt(now, 1)
+      // next period starts while call is recorded
+      clock.Advance(200 * time.Millisecond)
+      collector.Errors().AddAt(now, 1)
+    })
+
+    Convey("counters of call expire together", func() {
+      snapshot := collector.Snapshot(start.Add(10500 * time.Millisecond))
+      So(snapshot.Requests, ShouldEqual, 0)
+      So(snapshot.Errors, ShouldEqual, 0)
+    })
+  })
+}
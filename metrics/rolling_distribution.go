@@ -0,0 +1,201 @@
+package metrics
+
+import (
+  "sort"
+  "sync"
+  "time"
+  "breaker/clock"
+)
+
+// max number of samples stored in bucket, older samples are overwritten
+const bucketSamples = 1000
+
+type Distribution interface {
+  Add(value time.Duration)
+  // add sample to period of now instead of current one
+  AddAt(now time.Time, value time.Duration)
+  Percentile(p float64, now time.Time) time.Duration
+  Mean(now time.Time) time.Duration
+  Max(now time.Time) time.Duration
+  Snapshot(now time.Time) Latency
+}
+
+// latency stats of distribution samples in window
+type Latency struct {
+  Count int
+  Mean  time.Duration
+  Min   time.Duration
+  Max   time.Duration
+  P25   time.Duration
+  P50   time.Duration
+  P75   time.Duration
+  P90   time.Duration
+  P95   time.Duration
+  P99   time.Duration
+  P995  time.Duration
+}
+
+// distribution of durations for time period
+// samples are stored in circular array of buckets same way as rolling number values
+type rollingDistribution struct {
+  array    []*samplesBucket
+  slots    uint
+  period   time.Duration
+  mutex    sync.RWMutex
+  position int
+  clock    clock.Clock
+}
+
+// bucket holding samples
+type samplesBucket struct {
+  start   time.Time
+  samples []time.Duration
+  count   int
+}
+
+// create distribution with slots each holding samples for some period
+func CreateDistribution(slots uint, period time.Duration, clock clock.Clock) Distribution {
+  return &rollingDistribution{
+    array:  make([]*samplesBucket, slots),
+    slots:  slots,
+    period: period,
+    clock:  clock,
+  }
+}
+
+func (d *rollingDistribution) Add(value time.Duration) {
+  d.AddAt(d.clock.Now(), value)
+}
+
+func (d *rollingDistribution) AddAt(now time.Time, value time.Duration) {
+  d.mutex.Lock()
+  defer d.mutex.Unlock()
+
+  b := d.array[d.position]
+
+  if b == nil || b.start.Add(d.period).Before(now) {
+    if b != nil {
+      d.position = (d.position + 1) % len(d.array)
+    }
+
+    b = &samplesBucket{start: now, samples: make([]time.Duration, 0, 16)}
+    d.array[d.position] = b
+  }
+
+  if len(b.samples) < bucketSamples {
+    b.samples = append(b.samples, value)
+  } else {
+    b.samples[b.count%bucketSamples] = value
+  }
+
+  b.count++
+}
+
+// value below which p percent of samples fall (nearest rank)
+func (d *rollingDistribution) Percentile(p float64, now time.Time) time.Duration {
+  return percentileOf(d.samples(now), p)
+}
+
+func (d *rollingDistribution) Mean(now time.Time) time.Duration {
+  return meanOf(d.samples(now))
+}
+
+func (d *rollingDistribution) Max(now time.Time) time.Duration {
+  return maxOf(d.samples(now))
+}
+
+func (d *rollingDistribution) Snapshot(now time.Time) Latency {
+  return latencyOf(d.samples(now))
+}
+
+// copy of samples for time window of period * slots
+func (d *rollingDistribution) samples(now time.Time) []time.Duration {
+  d.mutex.RLock()
+  defer d.mutex.RUnlock()
+
+  window := d.period * time.Duration(d.slots)
+  var samples []time.Duration
+
+  for _, b := range d.array {
+    if b != nil && now.Sub(b.start) <= window && !b.start.After(now) {
+      samples = append(samples, b.samples...)
+    }
+  }
+
+  return samples
+}
+
+// stats calculated from the same samples, sorted once
+func latencyOf(samples []time.Duration) Latency {
+  sortSamples(samples)
+
+  return Latency{
+    Count: len(samples),
+    Mean:  meanOf(samples),
+    Min:   rankOf(samples, 0),
+    Max:   maxOf(samples),
+    P25:   rankOf(samples, 25),
+    P50:   rankOf(samples, 50),
+    P75:   rankOf(samples, 75),
+    P90:   rankOf(samples, 90),
+    P95:   rankOf(samples, 95),
+    P99:   rankOf(samples, 99),
+    P995:  rankOf(samples, 99.5),
+  }
+}
+
+// value below which p percent of samples fall (nearest rank)
+func percentileOf(samples []time.Duration, p float64) time.Duration {
+  sortSamples(samples)
+  return rankOf(samples, p)
+}
+
+func sortSamples(samples []time.Duration) {
+  sort.Slice(samples, func(i, j int) bool {
+    return samples[i] < samples[j]
+  })
+}
+
+// percentile of sorted samples
+func rankOf(samples []time.Duration, p float64) time.Duration {
+  if len(samples) == 0 {
+    return 0
+  }
+
+  rank := int(p/100*float64(len(samples)) + 0.5)
+
+  if rank < 1 {
+    rank = 1
+  }
+
+  if rank > len(samples) {
+    rank = len(samples)
+  }
+
+  return samples[rank-1]
+}
+
+func meanOf(samples []time.Duration) time.Duration {
+  if len(samples) == 0 {
+    return 0
+  }
+
+  var sum time.Duration
+  for _, sample := range samples {
+    sum += sample
+  }
+
+  return sum / time.Duration(len(samples))
+}
+
+func maxOf(samples []time.Duration) time.Duration {
+  var result time.Duration
+
+  for _, sample := range samples {
+    if sample > result {
+      result = sample
+    }
+  }
+
+  return result
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+  "breaker/clock"
+  "breaker/clock/fake"
+)
+
+func Test_Distribution(t *testing.T) {
+  Convey("add 100 samples", t, func() {
+    distribution := CreateDistribution(10, time.Second, clock.Real())
+
+    for i := 100; i > 0; i-- {
+      distribution.Add(time.Duration(i) * time.Millisecond)
+    }
+
+    now := time.Now()
+
+    Convey("percentiles are calculated", func() {
+      So(distribution.Percentile(0, now), ShouldEqual, time.Millisecond)
+      So(distribution.Percentile(50, now), ShouldEqual, 50*time.Millisecond)
+      So(distribution.Percentile(90, now), ShouldEqual, 90*time.Millisecond)
+      So(distribution.Percentile(99, now), ShouldEqual, 99*time.Millisecond)
+      So(distribution.Percentile(100, now), ShouldEqual, 100*time.Millisecond)
+    })
+
+    Convey("max and mean are calculated", func() {
+      So(distribution.Max(now), ShouldEqual, 100*time.Millisecond)
+      So(distribution.Mean(now), ShouldEqual, 50500*time.Microsecond)
+    })
+  })
+}
+
+func Test_Distribution_Empty(t *testing.T) {
+  Convey("empty distribution", t, func() {
+    distribution := CreateDistribution(10, time.Second, clock.Real())
+
+    Convey("all values are zero", func() {
+      So(distribution.Percentile(50, time.Now()), ShouldEqual, 0)
+      So(distribution.Mean(time.Now()), ShouldEqual, 0)
+      So(distribution.Max(time.Now()), ShouldEqual, 0)
+    })
+  })
+}
+
+func Test_Distribution_Expired(t *testing.T) {
+  Convey("add samples to distribution", t, func() {
+    clock := fake.NewClock(time.Now())
+    distribution := CreateDistribution(10, time.Millisecond*10, clock)
+
+    distribution.Add(time.Second)
+    clock.Advance(time.Millisecond * 50)
+    distribution.Add(time.Millisecond)
+    clock.Advance(time.Millisecond * 60)
+
+    Convey("measurement time (10ms * 10 slots = 100ms) expires for old samples", func() {
+      So(distribution.Max(clock.Now()), ShouldEqual, time.Millisecond)
+    })
+  })
+}
@@ -1,159 +1,113 @@
 package metrics
 
 import (
-  "sync"
+  "sync/atomic"
   "time"
-  "fmt"
+  "breaker/clock"
 )
 
 type Number interface {
   Increment()
   Add(value int64)
+  // add value to period of now instead of current one
+  AddAt(now time.Time, value int64)
   GetValue() int64
   Sum(time.Time) int64
 }
 
 // number holds rolling data for time period
-// data is stored in circular array of buckets
-// bucket stores some metrics - for example number of circuit executions
+// data is stored in ring of buckets, each bucket holds value for one period
+// bucket of expired period is replaced by bucket of current one
 type rollingNumber struct {
-  buckets circularArray
-}
-
-// circular array to store buckets
-type circularArray struct {
-  array    []*bucket
-  slots    uint
-  period   time.Duration
-  mutex    sync.RWMutex
-  position int
+  buckets []atomic.Pointer[bucket]
+  period  time.Duration
+  origin  time.Time // periods are counted from number creation
+  clock   clock.Clock
 }
 
 // bucket holding value
 type bucket struct {
+  epoch int64 // number of periods since origin
   value int64
-  start time.Time
-  adder chan int64
 }
 
 // create number with slots each holding data for some period
 // for example 10 slots 1 sec period each - data for 10 seconds
-func CreateNumber(slots uint, period time.Duration) Number {
+func CreateNumber(slots uint, period time.Duration, clock clock.Clock) Number {
   return &rollingNumber{
-    buckets: createCircularArray(slots, period),
+    buckets: make([]atomic.Pointer[bucket], slots),
+    period:  period,
+    origin:  clock.Now(),
+    clock:   clock,
   }
 }
 
 func (number *rollingNumber) Increment() {
-  currentBucket := number.buckets.getCurrentBucket()
-  currentBucket.adder <- 1
+  number.Add(1)
 }
 
 func (number *rollingNumber) Add(value int64) {
-  currentBucket := number.buckets.getCurrentBucket()
-  currentBucket.adder <- value
+  number.AddAt(number.clock.Now(), value)
 }
 
-func (number *rollingNumber) GetValue() int64 {
-  currentBucket := number.buckets.getCurrentBucket()
-  return currentBucket.value
+func (number *rollingNumber) AddAt(now time.Time, value int64) {
+  currentBucket := number.getBucket(number.epoch(now))
+  atomic.AddInt64(&currentBucket.value, value)
 }
 
-func (number *rollingNumber) Sum(time time.Time) int64 {
-  return number.buckets.Sum(time)
-}
+// value of current period
+func (number *rollingNumber) GetValue() int64 {
+  epoch := number.epoch(number.clock.Now())
 
-// create circular arrays with
-// - size - number of buckets
-// - timespan - timespan in ms of data stored in buckets (for example 100ms stored in bucket, 10 buckets - 1 sec array)
-func createCircularArray(slots uint, period time.Duration) circularArray {
-  return circularArray{
-    array:  make([]*bucket, slots),
-    slots:  slots,
-    period: period,
-    mutex:  sync.RWMutex{},
+  if b := number.slot(epoch).Load(); b != nil && b.epoch == epoch {
+    return atomic.LoadInt64(&b.value)
   }
-}
 
-func createBucket(time time.Time) *bucket {
-  bucket := bucket{0, time, make(chan int64)}
-
-  go func() {
-    for {
-      select {
-      case add := <-bucket.adder:
-        bucket.value += add
-      }
-    }
-  }()
-
-  return &bucket
+  return 0
 }
 
-func (ca *circularArray) getCurrentBucket() *bucket {
-  now := time.Now()
-
-  ca.mutex.Lock()
-  defer ca.mutex.Unlock()
-
-  if b := ca.array[ca.position]; b != nil {
-    if b.start.UnixNano()+ca.period.Nanoseconds() < now.UnixNano() {
-      ca.position = (ca.position + 1) % len(ca.array)
-      ca.array[ca.position] = createBucket(now)
-    }
-  } else {
-    ca.array[ca.position] = createBucket(now)
-    ca.position = ca.position % len(ca.array)
+// returns sum of bucket values for time window of period * slots ending at now
+func (number *rollingNumber) Sum(now time.Time) int64 {
+  if now.Before(number.origin) {
+    return 0
   }
 
-  return ca.array[ca.position]
-}
-
-// returns sum of bucket values for time window of period * slots
-func (ca *circularArray) Sum(now time.Time) int64 {
-  ca.mutex.Lock()
-  defer ca.mutex.Unlock()
+  epoch := number.epoch(now)
+  oldest := epoch - int64(len(number.buckets))
 
   var sum int64
 
-  for _, bucket := range ca.array {
-    if bucket != nil {
-      // sum of periods in each slot
-      numberRollingTime := ca.period.Nanoseconds() * int64(ca.slots)
-
-      // how much time passed since bucket was created
-      bucketStartTimePassed := now.Sub(bucket.start).Nanoseconds()
-
-      if bucketStartTimePassed <= numberRollingTime && bucket.start.Before(now) {
-        sum += bucket.value
-      }
+  for i := range number.buckets {
+    if b := number.buckets[i].Load(); b != nil && b.epoch > oldest && b.epoch <= epoch {
+      sum += atomic.LoadInt64(&b.value)
     }
   }
 
   return sum
 }
 
-func main() {
-  ca := createCircularArray(1, time.Second)
-
-  bucket1 := ca.getCurrentBucket()
-  fmt.Println(bucket1.start)
-  bucket2 := ca.getCurrentBucket()
-  fmt.Println(bucket2.start)
-  bucket3 := ca.getCurrentBucket()
-  fmt.Println(bucket3.start)
+func (number *rollingNumber) epoch(now time.Time) int64 {
+  return int64(now.Sub(number.origin) / number.period)
+}
 
-  time.Sleep(1000 * time.Millisecond)
+func (number *rollingNumber) slot(epoch int64) *atomic.Pointer[bucket] {
+  return &number.buckets[epoch%int64(len(number.buckets))]
+}
 
-  bucket4 := ca.getCurrentBucket()
-  fmt.Println(bucket4.start)
-  bucket5 := ca.getCurrentBucket()
-  fmt.Println(bucket5.start)
+// bucket of period, replaces bucket of expired period in the same slot
+// call delayed past newer period adds its value to newer bucket
+func (number *rollingNumber) getBucket(epoch int64) *bucket {
+  slot := number.slot(epoch)
 
-  time.Sleep(1000 * time.Millisecond)
+  for {
+    b := slot.Load()
+    if b != nil && b.epoch >= epoch {
+      return b
+    }
 
-  bucket6 := ca.getCurrentBucket()
-  fmt.Println(bucket6.start)
-  bucket7 := ca.getCurrentBucket()
-  fmt.Println(bucket7.start)
+    next := &bucket{epoch: epoch}
+    if slot.CompareAndSwap(b, next) {
+      return next
+    }
+  }
 }
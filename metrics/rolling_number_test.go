@@ -5,11 +5,14 @@ import (
   . "github.com/smartystreets/goconvey/convey"
   "time"
   "sync"
+  "runtime"
+  "breaker/clock"
+  "breaker/clock/fake"
 )
 
 func Test_Increment(t *testing.T) {
   Convey("run Increment command", t, func() {
-    number := CreateNumber(10, time.Millisecond*100)
+    number := CreateNumber(10, time.Millisecond*100, clock.Real())
 
     number.Increment()
 
@@ -21,7 +24,7 @@ func Test_Increment(t *testing.T) {
 
 func Test_Increment_Multi(t *testing.T) {
   Convey("run Increment command with concurrent calls", t, func() {
-    number := CreateNumber(10, time.Minute)
+    number := CreateNumber(10, time.Minute, clock.Real())
 
     expected := 100
 
@@ -36,7 +39,6 @@ func Test_Increment_Multi(t *testing.T) {
     }
 
     wg.Wait()
-    time.Sleep(time.Second)
 
     Convey("value should match number of increments", func() {
       So(number.GetValue(), ShouldEqual, expected)
@@ -46,16 +48,15 @@ func Test_Increment_Multi(t *testing.T) {
 
 func Test_Sum(t *testing.T) {
   Convey("run Sum command", t, func() {
-    number := CreateNumber(10, time.Millisecond*100)
+    clock := fake.NewClock(time.Now())
+    number := CreateNumber(10, time.Millisecond*100, clock)
 
     number.Increment()
-    time.Sleep(time.Millisecond * 10)
     value1 := number.GetValue()
 
-    time.Sleep(time.Millisecond * 100)
+    clock.Advance(time.Millisecond * 100)
 
     number.Increment()
-    time.Sleep(time.Millisecond * 10)
     value2 := number.GetValue()
 
     Convey("value1 should be correct", func() {
@@ -67,22 +68,82 @@ func Test_Sum(t *testing.T) {
     })
 
     Convey("sum over period of 1 sec", func() {
-      So(number.Sum(time.Now()), ShouldEqual, 2)
+      So(number.Sum(clock.Now()), ShouldEqual, 2)
     })
   })
 }
 
 func Test_Sum_Expired(t *testing.T) {
   Convey("run Sum command ", t, func() {
-    number := CreateNumber(10, time.Millisecond*10)
+    clock := fake.NewClock(time.Now())
+    number := CreateNumber(10, time.Millisecond*10, clock)
 
     number.Increment()
     number.Increment()
     number.Increment()
-    time.Sleep(time.Millisecond * 1000)
+    clock.Advance(time.Millisecond * 100)
 
     Convey("measurement time (10ms * 10 slots = 100ms) expires", func() {
-      So(number.Sum(time.Now()), ShouldEqual, 0)
+      So(number.Sum(clock.Now()), ShouldEqual, 0)
     })
   })
 }
+
+func Test_Increment_NoGoroutines(t *testing.T) {
+  Convey("run Increment command in many periods", t, func() {
+    goroutines := runtime.NumGoroutine()
+    clock := fake.NewClock(time.Now())
+    number := CreateNumber(10, time.Millisecond, clock)
+
+    for i := 0; i < 20; i++ {
+      number.Increment()
+      clock.Advance(time.Millisecond)
+    }
+
+    Convey("no goroutines are started", func() {
+      So(runtime.NumGoroutine(), ShouldBeLessThanOrEqualTo, goroutines)
+    })
+
+    Convey("expired buckets are reused", func() {
+      So(number.Sum(clock.Now()), ShouldEqual, 9)
+    })
+  })
+}
+
+func Benchmark_Increment(b *testing.B) {
+  number := CreateNumber(10, time.Millisecond*100, clock.Real())
+
+  b.RunParallel(func(pb *testing.PB) {
+    for pb.Next() {
+      number.Increment()
+    }
+  })
+}
+
+func Benchmark_Sum(b *testing.B) {
+  number := CreateNumber(10, time.Millisecond*100, clock.Real())
+  number.Increment()
+
+  b.RunParallel(func(pb *testing.PB) {
+    for pb.Next() {
+      number.Sum(time.Now())
+    }
+  })
+}
+
+func Benchmark_IncrementAndSum(b *testing.B) {
+  number := CreateNumber(10, time.Millisecond*100, clock.Real())
+
+  b.RunParallel(func(pb *testing.PB) {
+    i := 0
+    for pb.Next() {
+      // one Sum per ten increments like circuit checking calls
+      if i%10 == 0 {
+        number.Sum(time.Now())
+      } else {
+        number.Increment()
+      }
+      i++
+    }
+  })
+}
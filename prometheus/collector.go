@@ -0,0 +1,217 @@
+package prometheus
+
+import (
+  "breaker"
+  "breaker/metrics"
+  prom "github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "breaker"
+
+var circuitLabels = []string{"circuit"}
+
+// prometheus collector of circuits from breaker registry
+// state, limiter and worker pool are read on scrape,
+// call counters and latency histograms are updated on every finished call
+type Collector struct {
+  registry *breaker.Registry
+
+  totals      []total
+  counters    []counter // rolling window gauges, empty unless asked for
+  state       *prom.Desc
+  freeTickets *prom.Desc
+  limit       *prom.Desc
+  abandoned   *prom.Desc
+  queued      *prom.Desc
+  poolActive  *prom.Desc
+  poolQueued  *prom.Desc
+  latency     *prom.HistogramVec
+  queueWait   *prom.HistogramVec
+}
+
+// rolling counter of metrics collector
+type counter struct {
+  desc  *prom.Desc
+  value func(metrics.Snapshot) int64
+}
+
+// monotonic counter of finished calls
+type total struct {
+  vec    *prom.CounterVec
+  counts func(breaker.Execution) bool
+}
+
+// creates collector and subscribes it to registry executions
+// collector must be registered with prometheus registerer to be scraped
+func NewCollector(registry *breaker.Registry) *Collector {
+  return newCollector(registry, false)
+}
+
+// collector also exporting rolling window counters of circuits as gauges,
+// they show what circuit decides on but lose calls between scrapes - use *_total counters with rate()
+func NewCollectorWithRollingGauges(registry *breaker.Registry) *Collector {
+  return newCollector(registry, true)
+}
+
+func newCollector(registry *breaker.Registry, rolling bool) *Collector {
+  c := &Collector{
+    registry: registry,
+    totals: []total{
+      newTotal("requests_total", "Requests of circuit.",
+        func(e breaker.Execution) bool { return e.Event != breaker.ShortCircuitedEvent }),
+      newTotal("errors_total", "Failed requests of circuit.",
+        func(e breaker.Execution) bool { return e.Event != breaker.ShortCircuitedEvent && e.Event != breaker.SuccessEvent }),
+      newTotal("rejects_total", "Requests rejected by concurrent calls limit.",
+        func(e breaker.Execution) bool { return e.Event == breaker.RejectedEvent }),
+      newTotal("timeouts_total", "Timed out requests.",
+        func(e breaker.Execution) bool { return e.Event == breaker.TimeoutEvent }),
+      newTotal("cancelled_total", "Cancelled requests.",
+        func(e breaker.Execution) bool { return e.Event == breaker.CancelledEvent }),
+      newTotal("short_circuited_total", "Requests short circuited by open circuit.",
+        func(e breaker.Execution) bool { return e.Event == breaker.ShortCircuitedEvent }),
+      newTotal("slow_calls_total", "Calls slower than slow call duration.",
+        func(e breaker.Execution) bool { return e.Slow }),
+      newTotal("fallback_success_total", "Successful fallbacks.",
+        func(e breaker.Execution) bool { return e.Fallback == breaker.FallbackSuccessEvent }),
+      newTotal("fallback_failure_total", "Failed fallbacks.",
+        func(e breaker.Execution) bool { return e.Fallback == breaker.FallbackFailureEvent }),
+    },
+    state: prom.NewDesc(prom.BuildFQName(namespace, "", "state"),
+      "Circuit state: 0 closed, 1 open, 2 half open.", circuitLabels, nil),
+    freeTickets: prom.NewDesc(prom.BuildFQName(namespace, "", "limiter_free_tickets"),
+      "Free tickets of concurrent calls limiter.", circuitLabels, nil),
+    limit: prom.NewDesc(prom.BuildFQName(namespace, "", "limiter_limit"),
+      "Current concurrent calls limit, adjusted by adaptive limiter.", circuitLabels, nil),
+    abandoned: prom.NewDesc(prom.BuildFQName(namespace, "", "abandoned_executions"),
+      "Executions still running after their calls timed out or were cancelled.", circuitLabels, nil),
+    queued: prom.NewDesc(prom.BuildFQName(namespace, "", "queue_depth"),
+      "Calls waiting for concurrent calls limiter ticket.", circuitLabels, nil),
+    poolActive: prom.NewDesc(prom.BuildFQName(namespace, "pool", "active_workers"),
+      "Worker pool workers running execs.", circuitLabels, nil),
+    poolQueued: prom.NewDesc(prom.BuildFQName(namespace, "pool", "queued_tasks"),
+      "Execs waiting for worker pool worker.", circuitLabels, nil),
+    latency: prom.NewHistogramVec(prom.HistogramOpts{
+      Namespace: namespace,
+      Name:      "latency_seconds",
+      Help:      "Latency of circuit calls including fallback.",
+      Buckets:   prom.DefBuckets,
+    }, circuitLabels),
+    queueWait: prom.NewHistogramVec(prom.HistogramOpts{
+      Namespace: namespace,
+      Name:      "queue_wait_seconds",
+      Help:      "Time queued calls waited for concurrent calls limiter ticket.",
+      Buckets:   prom.DefBuckets,
+    }, circuitLabels),
+  }
+
+  if rolling {
+    c.counters = rollingCounters()
+  }
+
+  registry.OnExecution(func(execution breaker.Execution) {
+    for _, total := range c.totals {
+      if total.counts(execution) {
+        total.vec.WithLabelValues(execution.Name).Inc()
+      }
+    }
+
+    c.latency.WithLabelValues(execution.Name).Observe(execution.Latency.Seconds())
+
+    if execution.QueueWait > 0 {
+      c.queueWait.WithLabelValues(execution.Name).Observe(execution.QueueWait.Seconds())
+    }
+  })
+
+  return c
+}
+
+func rollingCounters() []counter {
+  return []counter{
+    newCounter("requests", "Requests in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.Requests }),
+    newCounter("errors", "Failed requests in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.Errors }),
+    newCounter("rejects", "Requests rejected by concurrent calls limit in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.Rejects }),
+    newCounter("timeouts", "Timed out requests in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.Timeouts }),
+    newCounter("cancelled", "Cancelled requests in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.Cancelled }),
+    newCounter("short_circuited", "Requests short circuited by open circuit in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.ShortCircuited }),
+    newCounter("slow_calls", "Calls slower than slow call duration in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.SlowCalls }),
+    newCounter("fallback_success", "Successful fallbacks in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.FallbackSuccess }),
+    newCounter("fallback_failure", "Failed fallbacks in rolling window.",
+      func(s metrics.Snapshot) int64 { return s.FallbackFailure }),
+  }
+}
+
+func newTotal(name string, help string, counts func(breaker.Execution) bool) total {
+  return total{
+    vec:    prom.NewCounterVec(prom.CounterOpts{Namespace: namespace, Name: name, Help: help}, circuitLabels),
+    counts: counts,
+  }
+}
+
+func newCounter(name string, help string, value func(metrics.Snapshot) int64) counter {
+  return counter{
+    desc:  prom.NewDesc(prom.BuildFQName(namespace, "rolling", name), help, circuitLabels, nil),
+    value: value,
+  }
+}
+
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+  for _, counter := range c.counters {
+    ch <- counter.desc
+  }
+
+  for _, total := range c.totals {
+    total.vec.Describe(ch)
+  }
+
+  ch <- c.state
+  ch <- c.freeTickets
+  ch <- c.limit
+  ch <- c.abandoned
+  ch <- c.queued
+  ch <- c.poolActive
+  ch <- c.poolQueued
+  c.latency.Describe(ch)
+  c.queueWait.Describe(ch)
+}
+
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+  now := c.registry.Clock().Now()
+
+  for _, circuit := range c.registry.Circuits() {
+    name := circuit.Name()
+
+    if len(c.counters) > 0 {
+      snapshot := circuit.Metrics().Snapshot(now)
+
+      for _, counter := range c.counters {
+        ch <- prom.MustNewConstMetric(counter.desc, prom.GaugeValue, float64(counter.value(snapshot)), name)
+      }
+    }
+
+    ch <- prom.MustNewConstMetric(c.state, prom.GaugeValue, float64(circuit.State()), name)
+    ch <- prom.MustNewConstMetric(c.freeTickets, prom.GaugeValue, float64(circuit.Limiter().Size()), name)
+    ch <- prom.MustNewConstMetric(c.limit, prom.GaugeValue, float64(circuit.ConcurrencyLimit()), name)
+    ch <- prom.MustNewConstMetric(c.abandoned, prom.GaugeValue, float64(circuit.Abandoned()), name)
+    ch <- prom.MustNewConstMetric(c.queued, prom.GaugeValue, float64(circuit.Queued()), name)
+
+    if pool := circuit.WorkerPool(); pool != nil {
+      ch <- prom.MustNewConstMetric(c.poolActive, prom.GaugeValue, float64(pool.Active()), name)
+      ch <- prom.MustNewConstMetric(c.poolQueued, prom.GaugeValue, float64(pool.Queued()), name)
+    }
+  }
+
+  for _, total := range c.totals {
+    total.vec.Collect(ch)
+  }
+
+  c.latency.Collect(ch)
+  c.queueWait.Collect(ch)
+}
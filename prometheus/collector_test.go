@@ -0,0 +1,126 @@
+package prometheus
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "context"
+  "fmt"
+  "strings"
+  "breaker"
+  prom "github.com/prometheus/client_golang/prometheus"
+  "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_Collector(t *testing.T) {
+  Convey("collect metrics of registry circuits", t, func() {
+    registry := breaker.NewRegistry()
+    circuit := registry.NewCircuit("payments", breaker.Settings{MaxConcurrentCalls: 5})
+
+    collector := NewCollectorWithRollingGauges(registry)
+    promRegistry := prom.NewPedanticRegistry()
+    promRegistry.MustRegister(collector)
+
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      return nil
+    }, nil)
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      return fmt.Errorf("exec failure")
+    }, func(ctx context.Context, err error) error {
+      return nil
+    })
+
+    Convey("rolling counters are exported", func() {
+      expected := `
+# HELP breaker_rolling_requests Requests in rolling window.
+# TYPE breaker_rolling_requests gauge
+breaker_rolling_requests{circuit="payments"} 2
+# HELP breaker_rolling_errors Failed requests in rolling window.
+# TYPE breaker_rolling_errors gauge
+breaker_rolling_errors{circuit="payments"} 1
+# HELP breaker_rolling_fallback_success Successful fallbacks in rolling window.
+# TYPE breaker_rolling_fallback_success gauge
+breaker_rolling_fallback_success{circuit="payments"} 1
+`
+      err := testutil.GatherAndCompare(promRegistry, strings.NewReader(expected),
+        "breaker_rolling_requests", "breaker_rolling_errors", "breaker_rolling_fallback_success")
+      So(err, ShouldBeNil)
+    })
+
+    Convey("call counters are exported", func() {
+      expected := `
+# HELP breaker_requests_total Requests of circuit.
+# TYPE breaker_requests_total counter
+breaker_requests_total{circuit="payments"} 2
+# HELP breaker_errors_total Failed requests of circuit.
+# TYPE breaker_errors_total counter
+breaker_errors_total{circuit="payments"} 1
+# HELP breaker_fallback_success_total Successful fallbacks.
+# TYPE breaker_fallback_success_total counter
+breaker_fallback_success_total{circuit="payments"} 1
+`
+      err := testutil.GatherAndCompare(promRegistry, strings.NewReader(expected),
+        "breaker_requests_total", "breaker_errors_total", "breaker_fallback_success_total")
+      So(err, ShouldBeNil)
+    })
+
+    Convey("state and limiter are exported", func() {
+      expected := `
+# HELP breaker_state Circuit state: 0 closed, 1 open, 2 half open.
+# TYPE breaker_state gauge
+breaker_state{circuit="payments"} 0
+# HELP breaker_limiter_free_tickets Free tickets of concurrent calls limiter.
+# TYPE breaker_limiter_free_tickets gauge
+breaker_limiter_free_tickets{circuit="payments"} 5
+# HELP breaker_limiter_limit Current concurrent calls limit, adjusted by adaptive limiter.
+# TYPE breaker_limiter_limit gauge
+breaker_limiter_limit{circuit="payments"} 5
+# HELP breaker_abandoned_executions Executions still running after their calls timed out or were cancelled.
+# TYPE breaker_abandoned_executions gauge
+breaker_abandoned_executions{circuit="payments"} 0
+`
+      err := testutil.GatherAndCompare(promRegistry, strings.NewReader(expected),
+        "breaker_state", "breaker_limiter_free_tickets", "breaker_limiter_limit", "breaker_abandoned_executions")
+      So(err, ShouldBeNil)
+    })
+
+    Convey("latency histogram is exported", func() {
+      count, err := testutil.GatherAndCount(promRegistry, "breaker_latency_seconds")
+      So(err, ShouldBeNil)
+      So(count, ShouldEqual, 1)
+      So(testutil.CollectAndCount(collector.latency), ShouldEqual, 1)
+    })
+  })
+}
+
+func Test_Collector_Totals(t *testing.T) {
+  Convey("collect metrics without rolling gauges", t, func() {
+    registry := breaker.NewRegistry()
+    circuit := registry.NewCircuit("orders", breaker.Settings{})
+
+    promRegistry := prom.NewPedanticRegistry()
+    promRegistry.MustRegister(NewCollector(registry))
+
+    circuit.ForceOpen()
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      return nil
+    }, nil)
+    // counters keep calls reset from rolling window
+    circuit.ResetMetrics()
+
+    Convey("short circuited calls are counted", func() {
+      expected := `
+# HELP breaker_short_circuited_total Requests short circuited by open circuit.
+# TYPE breaker_short_circuited_total counter
+breaker_short_circuited_total{circuit="orders"} 1
+`
+      err := testutil.GatherAndCompare(promRegistry, strings.NewReader(expected), "breaker_short_circuited_total")
+      So(err, ShouldBeNil)
+    })
+
+    Convey("rolling gauges are not exported", func() {
+      count, err := testutil.GatherAndCount(promRegistry, "breaker_rolling_requests")
+      So(err, ShouldBeNil)
+      So(count, ShouldEqual, 0)
+    })
+  })
+}
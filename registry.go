@@ -0,0 +1,225 @@
+package breaker
+
+import (
+  "sync"
+  "context"
+  "sort"
+  bsync "breaker/sync"
+  "breaker/clock"
+)
+
+// registry owns circuits, their settings and state listeners
+// package level functions use default registry
+type Registry struct {
+  mutex    sync.RWMutex
+  circuits map[string]*Circuit
+  clock    clock.Clock
+
+  settingsMutex sync.RWMutex
+  settings      map[string]Settings
+  defaults      Settings
+  envDefaults   []settingOverride
+  envCircuits   map[string][]settingOverride
+  fileCircuits  map[string]bool // circuits configured by last loaded file
+
+  poolsMutex   sync.Mutex
+  pools        map[poolKey]*bsync.WorkerPool
+  circuitPools map[string]poolKey // pool each circuit last used
+
+  listenersMutex        sync.RWMutex
+  listeners             map[string][]StateListener
+  globalListeners       []StateListener
+  executionListeners    []ExecutionListener
+  listenerErrorHandlers []ListenerErrorHandler
+}
+
+// circuits of group share pool only if they have the same pool size
+type poolKey struct {
+  group     string
+  workers   int
+  queueSize int
+}
+
+var defaultRegistry *Registry
+
+func init() {
+  defaultRegistry = NewRegistry()
+}
+
+// registry used by package level functions
+func DefaultRegistry() *Registry {
+  return defaultRegistry
+}
+
+func NewRegistry() *Registry {
+  return NewRegistryWithClock(clock.Real())
+}
+
+// registry using clock for metrics, sleep duration and timeouts
+func NewRegistryWithClock(clock clock.Clock) *Registry {
+  return &Registry{
+    circuits:  make(map[string]*Circuit),
+    clock:     clock,
+    settings:  make(map[string]Settings),
+    pools:     make(map[poolKey]*bsync.WorkerPool),
+    defaults:  packageDefaults(),
+
+    circuitPools: make(map[string]poolKey),
+    listeners: make(map[string][]StateListener),
+  }
+}
+
+// configures circuit and returns its handle
+func (r *Registry) NewCircuit(name string, s Settings) *Circuit {
+  r.ConfigureCircuit(name, s)
+  return r.getCircuit(name)
+}
+
+// returns circuit handle, circuit is created with current settings if it does not exist
+func (r *Registry) Circuit(name string) *Circuit {
+  return r.getCircuit(name)
+}
+
+// clock of registry circuits
+func (r *Registry) Clock() clock.Clock {
+  return r.clock
+}
+
+// returns circuit handle if circuit exists
+func (r *Registry) Lookup(name string) (*Circuit, bool) {
+  r.mutex.RLock()
+  defer r.mutex.RUnlock()
+
+  circuit, ok := r.circuits[name]
+  return circuit, ok
+}
+
+// all circuits created so far sorted by name
+func (r *Registry) Circuits() []*Circuit {
+  r.mutex.RLock()
+  defer r.mutex.RUnlock()
+
+  circuits := make([]*Circuit, 0, len(r.circuits))
+  for _, circuit := range r.circuits {
+    circuits = append(circuits, circuit)
+  }
+
+  sort.Slice(circuits, func(i, j int) bool {
+    return circuits[i].name < circuits[j].name
+  })
+
+  return circuits
+}
+
+func (r *Registry) getCircuit(name string) *Circuit {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  if _, ok := r.circuits[name]; !ok {
+    settings := r.GetSettings(name)
+
+    circuit := Circuit{
+      name:       name,
+      registry:   r,
+      metrics:    newCollector(settings, r.clock),
+      window:     windowOf(settings),
+      limiter:    newLimiter(settings),
+      limiterKey: limiterKeyOf(settings),
+      pool:       r.workerPool(name, settings),
+      events:     make(chan event),
+      changed:    make(chan struct{}, 1),
+    }
+
+    // listen to events
+    go func() {
+      // TODO allow to stop and exit loop
+      for {
+        select {
+        case event := <-circuit.events:
+          circuit.reportEvent(event)
+        case <-circuit.changed:
+          for _, change := range circuit.takeChanges() {
+            r.notifyListeners(change)
+          }
+        }
+      }
+    }()
+
+    r.circuits[name] = &circuit
+  }
+
+  return r.circuits[name]
+}
+
+// worker pool of circuit group and pool size, nil if circuit doesn't use pool isolation
+// called when circuit is created or configured, pool circuit used before is closed when no circuit uses it any more
+func (r *Registry) workerPool(name string, s Settings) *bsync.WorkerPool {
+  if s.Isolation != PoolIsolation {
+    r.releaseWorkerPool(name)
+    return nil
+  }
+
+  key := poolKey{s.PoolGroup, s.PoolWorkers, s.PoolQueueSize}
+  if key.group == "" {
+    key.group = name
+  }
+
+  r.poolsMutex.Lock()
+  defer r.poolsMutex.Unlock()
+
+  if old, ok := r.circuitPools[name]; !ok || old != key {
+    r.circuitPools[name] = key
+
+    if ok {
+      r.closeUnusedPool(old)
+    }
+  }
+
+  pool, ok := r.pools[key]
+  if !ok {
+    pool = bsync.NewWorkerPool(s.PoolWorkers, s.PoolQueueSize)
+    r.pools[key] = pool
+  }
+
+  return pool
+}
+
+// called when circuit stops using worker pool
+func (r *Registry) releaseWorkerPool(name string) {
+  r.poolsMutex.Lock()
+  defer r.poolsMutex.Unlock()
+
+  if old, ok := r.circuitPools[name]; ok {
+    delete(r.circuitPools, name)
+    r.closeUnusedPool(old)
+  }
+}
+
+// must be called with pools mutex locked
+func (r *Registry) closeUnusedPool(key poolKey) {
+  for _, used := range r.circuitPools {
+    if used == key {
+      return
+    }
+  }
+
+  if pool, ok := r.pools[key]; ok {
+    // queued calls are still run by old pool workers
+    pool.Close()
+    delete(r.pools, key)
+  }
+}
+
+// runs exec on named circuit, see Go
+func (r *Registry) Go(name string, ctx context.Context,
+  exec func(context.Context) error,
+  fail func(context.Context, error) error) chan error {
+  return r.getCircuit(name).Go(ctx, exec, fail)
+}
+
+// runs exec on named circuit, see Do
+func (r *Registry) Do(name string, ctx context.Context,
+  exec func(context.Context) error,
+  fail func(context.Context, error) error) error {
+  return r.getCircuit(name).Do(ctx, exec, fail)
+}
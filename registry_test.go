@@ -0,0 +1,66 @@
+package breaker
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "context"
+  "time"
+  "fmt"
+)
+
+func Test_Registry_Isolation(t *testing.T) {
+  Convey("two registries with circuit of the same name", t, func() {
+    registry1 := NewRegistry()
+    registry2 := NewRegistry()
+
+    circuit1 := registry1.NewCircuit("shared", Settings{
+      ErrorThreshold:         0.5,
+      RequestVolumeThreshold: 1,
+      SleepDuration:          time.Hour,
+    })
+    circuit2 := registry2.NewCircuit("shared", Settings{
+      Timeout: time.Millisecond * 10,
+    })
+
+    err := circuit1.Do(context.Background(), func(ctx context.Context) error {
+      return fmt.Errorf("exec failure")
+    }, nil)
+
+    Convey("settings are not shared", func() {
+      So(circuit1.Settings().ErrorThreshold, ShouldEqual, 0.5)
+      So(circuit2.Settings().ErrorThreshold, ShouldEqual, DefaultErrorThreshold)
+      So(circuit2.Settings().Timeout, ShouldEqual, time.Millisecond*10)
+      So(GetSettings("shared").Timeout, ShouldEqual, DefaultTimeout)
+    })
+
+    Convey("circuits are not shared", func() {
+      So(err, ShouldResemble, fmt.Errorf("exec failure"))
+      So(circuit1.AllowRequest(), ShouldBeFalse)
+      So(circuit1.State(), ShouldEqual, Open)
+
+      So(circuit2.AllowRequest(), ShouldBeTrue)
+      So(circuit2.State(), ShouldEqual, Closed)
+      So(circuit2.Metrics().Requests().Sum(time.Now()), ShouldEqual, 0)
+    })
+
+    Convey("registry returns the same handle for name", func() {
+      So(registry1.Circuit("shared"), ShouldEqual, circuit1)
+      So(registry1.Circuit("shared").Name(), ShouldEqual, "shared")
+    })
+  })
+}
+
+func Test_Registry_Execute(t *testing.T) {
+  Convey("run ExecuteCircuit on registry circuit", t, func() {
+    circuit := NewRegistry().NewCircuit("execute", Settings{})
+
+    value, err := ExecuteCircuit(circuit, context.Background(), func(ctx context.Context) (int, error) {
+      return 42, nil
+    }, nil)
+
+    Convey("exec value returned", func() {
+      So(value, ShouldEqual, 42)
+      So(err, ShouldBeNil)
+    })
+  })
+}
@@ -1,6 +1,7 @@
 package breaker
 
 import (
+  "fmt"
   "time"
 )
 
@@ -9,12 +10,131 @@ const (
   DefaultMaxConcurrentCalls = 1000
   DefaultErrorThreshold     = 0.05
   DefaultSleepDuration      = time.Second
+
+  DefaultRequestVolumeThreshold = 20
+
+  DefaultSlowCallDuration      = time.Minute
+  DefaultSlowCallRateThreshold = 1
+
+  DefaultMetricsWindowType  = TimeWindow
+  DefaultMetricsWindowCalls = 100
+  DefaultMetricsWindow      = 10 * time.Second
+  DefaultMetricsBuckets     = 10
+
+  DefaultHalfOpenMaxCalls         = 1
+  DefaultHalfOpenSuccessThreshold = 1
+
+  DefaultLimiterType        = FixedLimiter
+  DefaultMinConcurrentCalls = 1
+
+  DefaultIsolation     = GoroutineIsolation
+  DefaultPoolWorkers   = 10
+  DefaultPoolQueueSize = 0
 )
 
-var settings map[string]Settings
+// window circuit metrics are collected over
+// zero value is unset and means default window type
+type WindowType int
 
-func init() {
-  settings = make(map[string]Settings)
+const (
+  // calls of last rolling time period
+  TimeWindow WindowType = iota + 1
+  // last number of calls
+  CountWindow
+)
+
+func (windowType WindowType) String() string {
+  switch windowType {
+  case TimeWindow:
+    return "time"
+  case CountWindow:
+    return "count"
+  }
+
+  return "unknown"
+}
+
+func parseWindowType(value string) (WindowType, error) {
+  switch value {
+  case "time":
+    return TimeWindow, nil
+  case "count":
+    return CountWindow, nil
+  }
+
+  return 0, fmt.Errorf("unknown window type %q", value)
+}
+
+// how concurrent calls limit is set
+// zero value is unset and means default limiter type
+type LimiterType int
+
+const (
+  // limit is max concurrent calls
+  FixedLimiter LimiterType = iota + 1
+  // additive increase, multiplicative decrease
+  AIMDLimiter
+  // limit follows latency gradient
+  GradientLimiter
+)
+
+func (limiterType LimiterType) String() string {
+  switch limiterType {
+  case FixedLimiter:
+    return "fixed"
+  case AIMDLimiter:
+    return "aimd"
+  case GradientLimiter:
+    return "gradient"
+  }
+
+  return "unknown"
+}
+
+func parseLimiterType(value string) (LimiterType, error) {
+  switch value {
+  case "fixed":
+    return FixedLimiter, nil
+  case "aimd":
+    return AIMDLimiter, nil
+  case "gradient":
+    return GradientLimiter, nil
+  }
+
+  return 0, fmt.Errorf("unknown limiter type %q", value)
+}
+
+// how exec func is run
+// zero value is unset and means default isolation
+type Isolation int
+
+const (
+  // new goroutine for every call
+  GoroutineIsolation Isolation = iota + 1
+  // fixed number of workers with bounded queue
+  PoolIsolation
+)
+
+func (isolation Isolation) String() string {
+  switch isolation {
+  case GoroutineIsolation:
+    return "goroutine"
+  case PoolIsolation:
+    return "pool"
+  }
+
+  return "unknown"
+}
+
+func parseIsolation(value string) (Isolation, error) {
+  switch value {
+  case "goroutine":
+    return GoroutineIsolation, nil
+  case "pool":
+    return PoolIsolation, nil
+  }
+
+  return 0, fmt.Errorf("unknown isolation %q", value)
 }
 
 type Settings struct {
@@ -22,38 +142,311 @@ type Settings struct {
   MaxConcurrentCalls int
   ErrorThreshold     float32
   SleepDuration      time.Duration
+
+  // minimum number of requests in rolling window before error threshold is checked,
+  // capped at window calls of count based window
+  RequestVolumeThreshold int64
+
+  // calls taking at least slow call duration are slow
+  SlowCallDuration time.Duration
+  // ratio of slow calls in rolling window which opens circuit
+  SlowCallRateThreshold float32
+
+  // time or count based window of metrics used to open circuit
+  MetricsWindowType WindowType
+  // number of calls in count based window
+  MetricsWindowCalls int
+  // length of time based window
+  MetricsWindow time.Duration
+  // number of buckets time based window is split into, must divide window evenly
+  MetricsBuckets int
+
+  // number of concurrent test calls allowed in half open state
+  HalfOpenMaxCalls int
+  // number of successful test calls required to close circuit
+  HalfOpenSuccessThreshold int
+
+  // limiter ticket of timed out or cancelled call is held until its exec returns
+  // so hung execs count against max concurrent calls
+  HoldAbandonedTickets bool
+
+  // number of calls waiting for limiter ticket, calls are rejected right away if 0
+  MaxQueueSize int
+  // max time call waits in queue before rejection, limited by timeout if 0
+  MaxQueueWait time.Duration
+
+  // goroutine per call or worker pool
+  Isolation Isolation
+  // number of pool workers
+  PoolWorkers int
+  // number of calls waiting for pool worker, calls are rejected when all workers are busy if 0
+  PoolQueueSize int
+  // circuits of the same group and pool size share pool, circuit has own pool if empty
+  // circuits of group should have the same pool settings
+  PoolGroup string
+
+  // fixed or adaptive limiter, adaptive limit starts at max concurrent calls
+  // and is adjusted from latency and errors of calls
+  LimiterType LimiterType
+  // lowest limit of adaptive limiter
+  MinConcurrentCalls int
 }
 
 func ConfigureCircuit(name string, s Settings) Settings {
-  if s.ErrorThreshold == 0 {
-    s.ErrorThreshold = DefaultErrorThreshold
+  return defaultRegistry.ConfigureCircuit(name, s)
+}
+
+func ConfigureDefaults(s Settings) Settings {
+  return defaultRegistry.ConfigureDefaults(s)
+}
+
+func GetSettings(name string) Settings {
+  return defaultRegistry.GetSettings(name)
+}
+
+// stores circuit settings, zero fields follow registry defaults including ones configured later
+// settings of existing circuit are applied to its next calls
+// panics if settings are invalid
+func (r *Registry) ConfigureCircuit(name string, s Settings) Settings {
+  // no circuit can be created while settings are changed
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  r.settingsMutex.Lock()
+  resolved := r.resolve(name, s)
+  err := resolved.validate()
+  if err == nil {
+    r.settings[name] = s
   }
+  r.settingsMutex.Unlock()
 
-  if s.SleepDuration == 0 {
-    s.SleepDuration = DefaultSleepDuration
+  if err != nil {
+    panic(fmt.Sprintf("breaker: circuit %s: %s", name, err))
   }
 
-  if s.MaxConcurrentCalls == 0 {
-    s.MaxConcurrentCalls = DefaultMaxConcurrentCalls
+  if circuit, ok := r.circuits[name]; ok {
+    circuit.applySettings(resolved)
   }
 
-  if s.Timeout == 0 {
-    s.Timeout = DefaultTimeout
+  return resolved
+}
+
+// stores settings used by circuits without own settings
+// zero fields are set to package defaults
+// panics if settings are invalid
+func (r *Registry) ConfigureDefaults(s Settings) Settings {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  r.settingsMutex.Lock()
+  defer r.settingsMutex.Unlock()
+
+  s = withDefaults(s, packageDefaults())
+  if err := r.validateDefaults(s); err != nil {
+    panic(fmt.Sprintf("breaker: defaults: %s", err))
+  }
+
+  r.defaults = s
+
+  // configured circuits take their zero fields from defaults too
+  for name, circuit := range r.circuits {
+    circuit.applySettings(r.getSettings(name))
   }
 
-  settings[name] = s
   return s
 }
 
-func GetSettings(name string) Settings {
-  if s, ok := settings[name]; ok {
-    return s
+// checks settings every circuit would get with defaults
+// must be called with settings mutex locked
+func (r *Registry) validateDefaults(defaults Settings) error {
+  defaults = applyOverrides(defaults, r.envDefaults)
+  if err := defaults.validate(); err != nil {
+    return err
+  }
+
+  for name, s := range r.settings {
+    if err := applyOverrides(withDefaults(s, defaults), r.envCircuits[envName(name)]).validate(); err != nil {
+      return fmt.Errorf("circuit %s: %s", name, err)
+    }
   }
 
+  for name, overrides := range r.envCircuits {
+    if err := applyOverrides(defaults, overrides).validate(); err != nil {
+      return fmt.Errorf("%s%s: %s", envPrefix, name, err)
+    }
+  }
+
+  return nil
+}
+
+// settings of circuit with environment overrides applied
+func (r *Registry) GetSettings(name string) Settings {
+  r.settingsMutex.RLock()
+  defer r.settingsMutex.RUnlock()
+
+  return r.getSettings(name)
+}
+
+// must be called with settings mutex locked
+func (r *Registry) getSettings(name string) Settings {
+  return r.resolve(name, r.settings[name])
+}
+
+// circuit settings over current defaults and environment overrides
+// must be called with settings mutex locked
+func (r *Registry) resolve(name string, s Settings) Settings {
+  s = withDefaults(s, applyOverrides(r.defaults, r.envDefaults))
+  return applyOverrides(s, r.envCircuits[envName(name)])
+}
+
+func packageDefaults() Settings {
   return Settings{
     DefaultTimeout,
     DefaultMaxConcurrentCalls,
     DefaultErrorThreshold,
     DefaultSleepDuration,
+    DefaultRequestVolumeThreshold,
+    DefaultSlowCallDuration,
+    DefaultSlowCallRateThreshold,
+    DefaultMetricsWindowType,
+    DefaultMetricsWindowCalls,
+    DefaultMetricsWindow,
+    DefaultMetricsBuckets,
+    DefaultHalfOpenMaxCalls,
+    DefaultHalfOpenSuccessThreshold,
+    false,
+    0,
+    0,
+    DefaultIsolation,
+    DefaultPoolWorkers,
+    DefaultPoolQueueSize,
+    "",
+    DefaultLimiterType,
+    DefaultMinConcurrentCalls,
+  }
+}
+
+// time based window must be split into buckets of equal length
+// count based window and concurrent calls limit must be positive
+// worker pool must have workers
+// adaptive limit must have range
+func (s Settings) validate() error {
+  if s.MaxConcurrentCalls <= 0 {
+    return fmt.Errorf("max concurrent calls %d must be positive", s.MaxConcurrentCalls)
+  }
+
+  if s.MetricsWindowCalls <= 0 {
+    return fmt.Errorf("metrics window calls %d must be positive", s.MetricsWindowCalls)
+  }
+
+  if s.MetricsWindow <= 0 || s.MetricsBuckets <= 0 {
+    return fmt.Errorf("metrics window %s and buckets %d must be positive", s.MetricsWindow, s.MetricsBuckets)
+  }
+
+  if s.MetricsWindow%time.Duration(s.MetricsBuckets) != 0 {
+    return fmt.Errorf("metrics window %s can't be split into %d buckets evenly", s.MetricsWindow, s.MetricsBuckets)
+  }
+
+  if s.PoolWorkers <= 0 || s.PoolQueueSize < 0 {
+    return fmt.Errorf("pool workers %d must be positive and queue size %d not negative", s.PoolWorkers, s.PoolQueueSize)
+  }
+
+  if s.LimiterType != FixedLimiter && (s.MinConcurrentCalls <= 0 || s.MinConcurrentCalls > s.MaxConcurrentCalls) {
+    return fmt.Errorf("min concurrent calls %d must be between 1 and max concurrent calls %d", s.MinConcurrentCalls, s.MaxConcurrentCalls)
+  }
+
+  return nil
+}
+
+// sets zero fields of settings to default values
+func withDefaults(s Settings, defaults Settings) Settings {
+  if s.ErrorThreshold == 0 {
+    s.ErrorThreshold = defaults.ErrorThreshold
+  }
+
+  if s.SleepDuration == 0 {
+    s.SleepDuration = defaults.SleepDuration
+  }
+
+  if s.MaxConcurrentCalls == 0 {
+    s.MaxConcurrentCalls = defaults.MaxConcurrentCalls
+  }
+
+  if s.Timeout == 0 {
+    s.Timeout = defaults.Timeout
+  }
+
+  if s.RequestVolumeThreshold == 0 {
+    s.RequestVolumeThreshold = defaults.RequestVolumeThreshold
   }
+
+  if s.SlowCallDuration == 0 {
+    s.SlowCallDuration = defaults.SlowCallDuration
+  }
+
+  if s.SlowCallRateThreshold == 0 {
+    s.SlowCallRateThreshold = defaults.SlowCallRateThreshold
+  }
+
+  if s.MetricsWindowType == 0 {
+    s.MetricsWindowType = defaults.MetricsWindowType
+  }
+
+  if s.MetricsWindowCalls == 0 {
+    s.MetricsWindowCalls = defaults.MetricsWindowCalls
+  }
+
+  if s.MetricsWindow == 0 {
+    s.MetricsWindow = defaults.MetricsWindow
+  }
+
+  if s.MetricsBuckets == 0 {
+    s.MetricsBuckets = defaults.MetricsBuckets
+  }
+
+  if s.HalfOpenMaxCalls == 0 {
+    s.HalfOpenMaxCalls = defaults.HalfOpenMaxCalls
+  }
+
+  if s.HalfOpenSuccessThreshold == 0 {
+    s.HalfOpenSuccessThreshold = defaults.HalfOpenSuccessThreshold
+  }
+
+  if !s.HoldAbandonedTickets {
+    s.HoldAbandonedTickets = defaults.HoldAbandonedTickets
+  }
+
+  if s.MaxQueueSize == 0 {
+    s.MaxQueueSize = defaults.MaxQueueSize
+  }
+
+  if s.MaxQueueWait == 0 {
+    s.MaxQueueWait = defaults.MaxQueueWait
+  }
+
+  if s.Isolation == 0 {
+    s.Isolation = defaults.Isolation
+  }
+
+  if s.PoolWorkers == 0 {
+    s.PoolWorkers = defaults.PoolWorkers
+  }
+
+  if s.PoolQueueSize == 0 {
+    s.PoolQueueSize = defaults.PoolQueueSize
+  }
+
+  if s.PoolGroup == "" {
+    s.PoolGroup = defaults.PoolGroup
+  }
+
+  if s.LimiterType == 0 {
+    s.LimiterType = defaults.LimiterType
+  }
+
+  if s.MinConcurrentCalls == 0 {
+    s.MinConcurrentCalls = defaults.MinConcurrentCalls
+  }
+
+  return s
 }
@@ -0,0 +1,158 @@
+package breaker
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+  "sync"
+)
+
+func Test_ConfigureCircuit_Live(t *testing.T) {
+  Convey("reconfigure existing circuit", t, func() {
+    registry := NewRegistry()
+    circuit := registry.NewCircuit("live", Settings{MaxConcurrentCalls: 2})
+
+    size1 := circuit.limiter.Size()
+
+    settings := circuit.Settings()
+    settings.MaxConcurrentCalls = 5
+    settings.Timeout = time.Millisecond * 100
+    settings.SleepDuration = time.Minute
+    circuit.Configure(settings)
+
+    Convey("limiter is resized", func() {
+      So(size1, ShouldEqual, 2)
+      So(circuit.limiter.Size(), ShouldEqual, 5)
+    })
+
+    Convey("new settings are used", func() {
+      So(circuit.Settings().Timeout, ShouldEqual, time.Millisecond*100)
+      So(circuit.Settings().SleepDuration, ShouldEqual, time.Minute)
+      So(registry.GetSettings("live").MaxConcurrentCalls, ShouldEqual, 5)
+    })
+  })
+}
+
+func Test_ConfigureCircuit_Concurrent(t *testing.T) {
+  Convey("configure and read settings concurrently", t, func() {
+    registry := NewRegistry()
+
+    wg := sync.WaitGroup{}
+    wg.Add(200)
+
+    for i := 0; i < 100; i++ {
+      go func(i int) {
+        defer wg.Done()
+        registry.ConfigureCircuit("concurrent", Settings{MaxConcurrentCalls: i + 1})
+      }(i)
+
+      go func() {
+        defer wg.Done()
+        registry.Circuit("concurrent").Settings()
+      }()
+    }
+
+    wg.Wait()
+
+    Convey("limiter matches last settings", func() {
+      circuit := registry.Circuit("concurrent")
+      So(circuit.limiter.Size(), ShouldEqual, circuit.Settings().MaxConcurrentCalls)
+    })
+  })
+}
+
+func Test_ConfigureCircuit_MetricsWindow(t *testing.T) {
+  Convey("configure time window of circuit", t, func() {
+    registry := NewRegistry()
+    circuit := registry.NewCircuit("window", Settings{MetricsWindow: time.Second, MetricsBuckets: 4})
+
+    circuit.reportEvent(event{rootEvent: failure})
+
+    Convey("requests expire after window", func() {
+      So(circuit.Metrics().Requests().Sum(time.Now()), ShouldEqual, 1)
+      So(circuit.Metrics().Requests().Sum(time.Now().Add(2*time.Second)), ShouldEqual, 0)
+    })
+
+    Convey("window not divisible into buckets is rejected", func() {
+      So(func() {
+        registry.ConfigureCircuit("window", Settings{MetricsWindow: time.Second, MetricsBuckets: 3})
+      }, ShouldPanic)
+      So(registry.GetSettings("window").MetricsBuckets, ShouldEqual, 4)
+    })
+
+    Convey("invalid defaults are rejected", func() {
+      So(func() { registry.ConfigureDefaults(Settings{MetricsBuckets: -1}) }, ShouldPanic)
+    })
+
+    Convey("negative window calls are rejected", func() {
+      So(func() {
+        registry.ConfigureCircuit("window", Settings{MetricsWindowType: CountWindow, MetricsWindowCalls: -1})
+      }, ShouldPanic)
+      So(registry.GetSettings("window").MetricsWindowType, ShouldEqual, TimeWindow)
+    })
+
+    Convey("negative max concurrent calls are rejected", func() {
+      So(func() { registry.ConfigureCircuit("window", Settings{MaxConcurrentCalls: -1}) }, ShouldPanic)
+      So(func() { registry.ConfigureDefaults(Settings{MaxConcurrentCalls: -1}) }, ShouldPanic)
+    })
+  })
+}
+
+func Test_ConfigureCircuit_WindowType(t *testing.T) {
+  Convey("configure time window over count window defaults", t, func() {
+    registry := NewRegistry()
+    registry.ConfigureDefaults(Settings{MetricsWindowType: CountWindow})
+
+    registry.ConfigureCircuit("time", Settings{MetricsWindowType: TimeWindow})
+    registry.ConfigureCircuit("unset", Settings{})
+
+    Convey("explicit time window is kept", func() {
+      So(registry.GetSettings("time").MetricsWindowType, ShouldEqual, TimeWindow)
+    })
+
+    Convey("unset window type is taken from defaults", func() {
+      So(registry.GetSettings("unset").MetricsWindowType, ShouldEqual, CountWindow)
+    })
+
+    Convey("zero window type is unset", func() {
+      So(WindowType(0).String(), ShouldEqual, "unknown")
+    })
+  })
+}
+
+func Test_ConfigureCircuit_Isolation(t *testing.T) {
+  Convey("configure goroutine isolation over pool isolation defaults", t, func() {
+    registry := NewRegistry()
+    registry.ConfigureDefaults(Settings{Isolation: PoolIsolation})
+
+    registry.ConfigureCircuit("goroutine", Settings{Isolation: GoroutineIsolation})
+    registry.ConfigureCircuit("unset", Settings{})
+
+    Convey("explicit goroutine isolation is kept", func() {
+      So(registry.GetSettings("goroutine").Isolation, ShouldEqual, GoroutineIsolation)
+      So(registry.Circuit("goroutine").WorkerPool(), ShouldBeNil)
+    })
+
+    Convey("unset isolation is taken from defaults", func() {
+      So(registry.GetSettings("unset").Isolation, ShouldEqual, PoolIsolation)
+    })
+  })
+}
+
+func Test_ConfigureCircuit_LimiterType(t *testing.T) {
+  Convey("configure fixed limiter over adaptive limiter defaults", t, func() {
+    registry := NewRegistry()
+    registry.ConfigureDefaults(Settings{LimiterType: AIMDLimiter})
+
+    registry.ConfigureCircuit("fixed", Settings{LimiterType: FixedLimiter})
+    registry.ConfigureCircuit("unset", Settings{})
+
+    Convey("explicit fixed limiter is kept", func() {
+      So(registry.GetSettings("fixed").LimiterType, ShouldEqual, FixedLimiter)
+    })
+
+    Convey("unset limiter type is taken from defaults", func() {
+      So(registry.GetSettings("unset").LimiterType, ShouldEqual, AIMDLimiter)
+    })
+  })
+}
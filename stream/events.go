@@ -0,0 +1,85 @@
+package stream
+
+// HystrixCommand event
+type commandMetrics struct {
+  Type           string `json:"type"`
+  Name           string `json:"name"`
+  Group          string `json:"group"`
+  ReportingHosts int64  `json:"reportingHosts"`
+  CurrentTime    int64  `json:"currentTime"`
+
+  RequestCount         int64 `json:"requestCount"`
+  ErrorCount           int64 `json:"errorCount"`
+  ErrorPercentage      int64 `json:"errorPercentage"`
+  IsCircuitBreakerOpen bool  `json:"isCircuitBreakerOpen"`
+
+  RollingCountCollapsedRequests  int64 `json:"rollingCountCollapsedRequests"`
+  RollingCountExceptionsThrown   int64 `json:"rollingCountExceptionsThrown"`
+  RollingCountFailure            int64 `json:"rollingCountFailure"`
+  RollingCountFallbackFailure    int64 `json:"rollingCountFallbackFailure"`
+  RollingCountFallbackRejection  int64 `json:"rollingCountFallbackRejection"`
+  RollingCountFallbackSuccess    int64 `json:"rollingCountFallbackSuccess"`
+  RollingCountResponsesFromCache int64 `json:"rollingCountResponsesFromCache"`
+  RollingCountSemaphoreRejected  int64 `json:"rollingCountSemaphoreRejected"`
+  RollingCountShortCircuited     int64 `json:"rollingCountShortCircuited"`
+  RollingCountSuccess            int64 `json:"rollingCountSuccess"`
+  RollingCountThreadPoolRejected int64 `json:"rollingCountThreadPoolRejected"`
+  RollingCountTimeout            int64 `json:"rollingCountTimeout"`
+
+  CurrentConcurrentExecutionCount int64 `json:"currentConcurrentExecutionCount"`
+
+  LatencyExecuteMean int64   `json:"latencyExecute_mean"`
+  LatencyExecute     latency `json:"latencyExecute"`
+  LatencyTotalMean   int64   `json:"latencyTotal_mean"`
+  LatencyTotal       latency `json:"latencyTotal"`
+
+  SleepWindowInMilliseconds                        int64  `json:"propertyValue_circuitBreakerSleepWindowInMilliseconds"`
+  RequestVolumeThreshold                           int64  `json:"propertyValue_circuitBreakerRequestVolumeThreshold"`
+  ErrorThresholdPercentage                         int64  `json:"propertyValue_circuitBreakerErrorThresholdPercentage"`
+  CircuitBreakerEnabled                            bool   `json:"propertyValue_circuitBreakerEnabled"`
+  ForceOpen                                        bool   `json:"propertyValue_circuitBreakerForceOpen"`
+  ForceClosed                                      bool   `json:"propertyValue_circuitBreakerForceClosed"`
+  ExecutionIsolationStrategy                       string `json:"propertyValue_executionIsolationStrategy"`
+  ExecutionIsolationThreadTimeoutInMilliseconds    int64  `json:"propertyValue_executionIsolationThreadTimeoutInMilliseconds"`
+  ExecutionIsolationThreadInterruptOnTimeout       bool   `json:"propertyValue_executionIsolationThreadInterruptOnTimeout"`
+  ExecutionIsolationSemaphoreMaxConcurrentRequests int64  `json:"propertyValue_executionIsolationSemaphoreMaxConcurrentRequests"`
+  FallbackIsolationSemaphoreMaxConcurrentRequests  int64  `json:"propertyValue_fallbackIsolationSemaphoreMaxConcurrentRequests"`
+  RollingStatsWindowInMilliseconds                 int64  `json:"propertyValue_metricsRollingStatisticalWindowInMilliseconds"`
+  RequestCacheEnabled                              bool   `json:"propertyValue_requestCacheEnabled"`
+  RequestLogEnabled                                bool   `json:"propertyValue_requestLogEnabled"`
+}
+
+// latency percentiles in milliseconds
+type latency struct {
+  P0   int64 `json:"0"`
+  P25  int64 `json:"25"`
+  P50  int64 `json:"50"`
+  P75  int64 `json:"75"`
+  P90  int64 `json:"90"`
+  P95  int64 `json:"95"`
+  P99  int64 `json:"99"`
+  P995 int64 `json:"99.5"`
+  P100 int64 `json:"100"`
+}
+
+// HystrixThreadPool event
+type threadPoolMetrics struct {
+  Type           string `json:"type"`
+  Name           string `json:"name"`
+  ReportingHosts int64  `json:"reportingHosts"`
+
+  CurrentActiveCount        int64 `json:"currentActiveCount"`
+  CurrentCompletedTaskCount int64 `json:"currentCompletedTaskCount"`
+  CurrentCorePoolSize       int64 `json:"currentCorePoolSize"`
+  CurrentLargestPoolSize    int64 `json:"currentLargestPoolSize"`
+  CurrentMaximumPoolSize    int64 `json:"currentMaximumPoolSize"`
+  CurrentPoolSize           int64 `json:"currentPoolSize"`
+  CurrentQueueSize          int64 `json:"currentQueueSize"`
+  CurrentTaskCount          int64 `json:"currentTaskCount"`
+
+  RollingCountThreadsExecuted int64 `json:"rollingCountThreadsExecuted"`
+  RollingMaxActiveThreads     int64 `json:"rollingMaxActiveThreads"`
+
+  QueueSizeRejectionThreshold      int64 `json:"propertyValue_queueSizeRejectionThreshold"`
+  RollingStatsWindowInMilliseconds int64 `json:"propertyValue_metricsRollingStatisticalWindowInMilliseconds"`
+}
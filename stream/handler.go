@@ -0,0 +1,213 @@
+package stream
+
+import (
+  "encoding/json"
+  "net/http"
+  "time"
+  "breaker"
+  "breaker/metrics"
+)
+
+// http handler streaming circuit metrics as server sent events
+// in hystrix dashboard format (hystrix.stream)
+type Handler struct {
+  registry *breaker.Registry
+  interval time.Duration
+}
+
+func NewHandler(registry *breaker.Registry, interval time.Duration) *Handler {
+  return &Handler{
+    registry: registry,
+    interval: interval,
+  }
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  flusher, ok := w.(http.Flusher)
+  if !ok {
+    http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+    return
+  }
+
+  w.Header().Set("Content-Type", "text/event-stream")
+  w.Header().Set("Cache-Control", "no-cache")
+  w.Header().Set("Connection", "keep-alive")
+  w.Header().Set("Access-Control-Allow-Origin", "*")
+  w.WriteHeader(http.StatusOK)
+
+  ticker := time.NewTicker(h.interval)
+  defer ticker.Stop()
+
+  for {
+    if err := h.writeEvents(w); err != nil {
+      return
+    }
+
+    flusher.Flush()
+
+    select {
+    case <-r.Context().Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
+
+func (h *Handler) writeEvents(w http.ResponseWriter) error {
+  circuits := h.registry.Circuits()
+
+  if len(circuits) == 0 {
+    _, err := w.Write([]byte("ping: \n\n"))
+    return err
+  }
+
+  now := h.registry.Clock().Now()
+
+  for _, circuit := range circuits {
+    settings := circuit.Settings()
+    snapshot := circuit.Metrics().Snapshot(now)
+
+    if err := writeEvent(w, commandEvent(circuit, settings, snapshot, now)); err != nil {
+      return err
+    }
+
+    if err := writeEvent(w, threadPoolEvent(circuit, settings, snapshot)); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+func writeEvent(w http.ResponseWriter, event interface{}) error {
+  data, err := json.Marshal(event)
+  if err != nil {
+    return err
+  }
+
+  if _, err := w.Write([]byte("data: ")); err != nil {
+    return err
+  }
+
+  if _, err := w.Write(data); err != nil {
+    return err
+  }
+
+  _, err = w.Write([]byte("\n\n"))
+  return err
+}
+
+func commandEvent(circuit *breaker.Circuit, settings breaker.Settings, s metrics.Snapshot, now time.Time) commandMetrics {
+  errorPercentage := int64(0)
+  if s.Requests > 0 {
+    errorPercentage = s.Errors * 100 / s.Requests
+  }
+
+  return commandMetrics{
+    Type:           "HystrixCommand",
+    Name:           circuit.Name(),
+    Group:          circuit.Name(),
+    ReportingHosts: 1,
+    CurrentTime:    now.UnixNano() / int64(time.Millisecond),
+
+    RequestCount:         s.Requests,
+    ErrorCount:           s.Errors,
+    ErrorPercentage:      errorPercentage,
+    IsCircuitBreakerOpen: circuit.State() != breaker.Closed,
+
+    RollingCountFailure:            s.Errors - s.Rejects - s.Timeouts - s.Cancelled,
+    RollingCountFallbackFailure:    s.FallbackFailure,
+    RollingCountFallbackSuccess:    s.FallbackSuccess,
+    RollingCountSemaphoreRejected:  s.Rejects,
+    RollingCountShortCircuited:     s.ShortCircuited,
+    RollingCountSuccess:            s.Requests - s.Errors,
+    RollingCountTimeout:            s.Timeouts,
+    CurrentConcurrentExecutionCount: activeCount(circuit),
+
+    LatencyExecuteMean: milliseconds(s.ExecutionLatency.Mean),
+    LatencyExecute:     latencyPercentiles(s.ExecutionLatency),
+    LatencyTotalMean:   milliseconds(s.TotalLatency.Mean),
+    LatencyTotal:       latencyPercentiles(s.TotalLatency),
+
+    SleepWindowInMilliseconds:                        milliseconds(settings.SleepDuration),
+    RequestVolumeThreshold:                           settings.RequestVolumeThreshold,
+    ErrorThresholdPercentage:                         int64(settings.ErrorThreshold * 100),
+    CircuitBreakerEnabled:                            true,
+    ExecutionIsolationStrategy:                       isolationStrategy(settings),
+    ExecutionIsolationThreadTimeoutInMilliseconds:    milliseconds(settings.Timeout),
+    ExecutionIsolationSemaphoreMaxConcurrentRequests: int64(circuit.ConcurrencyLimit()),
+    RollingStatsWindowInMilliseconds:                 milliseconds(settings.MetricsWindow),
+    ForceOpen:                                        circuit.Mode() == breaker.ForcedOpen,
+    ForceClosed:                                      circuit.Mode() == breaker.ForcedClosed,
+  }
+}
+
+func threadPoolEvent(circuit *breaker.Circuit, settings breaker.Settings, s metrics.Snapshot) threadPoolMetrics {
+  poolSize := int64(circuit.ConcurrencyLimit())
+  active := activeCount(circuit)
+  queued := circuit.Queued()
+  queueSize := int64(settings.MaxQueueSize)
+
+  // worker pool is reported instead of limiter
+  if pool := circuit.WorkerPool(); pool != nil {
+    poolSize = int64(pool.Workers())
+    active = int64(pool.Active())
+    queued = int64(pool.Queued())
+    queueSize = int64(pool.QueueSize())
+  }
+
+  return threadPoolMetrics{
+    Type:           "HystrixThreadPool",
+    Name:           circuit.Name(),
+    ReportingHosts: 1,
+
+    CurrentActiveCount:     active,
+    CurrentCorePoolSize:    poolSize,
+    CurrentLargestPoolSize: poolSize,
+    CurrentMaximumPoolSize: poolSize,
+    CurrentPoolSize:        poolSize,
+    CurrentQueueSize:       queued,
+
+    RollingCountThreadsExecuted: s.Requests - s.Rejects,
+
+    QueueSizeRejectionThreshold: queueSize,
+
+    RollingStatsWindowInMilliseconds: milliseconds(settings.MetricsWindow),
+  }
+}
+
+func latencyPercentiles(l metrics.Latency) latency {
+  return latency{
+    P0:   milliseconds(l.Min),
+    P25:  milliseconds(l.P25),
+    P50:  milliseconds(l.P50),
+    P75:  milliseconds(l.P75),
+    P90:  milliseconds(l.P90),
+    P95:  milliseconds(l.P95),
+    P99:  milliseconds(l.P99),
+    P995: milliseconds(l.P995),
+    P100: milliseconds(l.Max),
+  }
+}
+
+// calls holding limiter tickets
+func activeCount(circuit *breaker.Circuit) int64 {
+  active := circuit.ConcurrencyLimit() - circuit.Limiter().Size()
+  if active < 0 {
+    return 0
+  }
+
+  return int64(active)
+}
+
+func isolationStrategy(settings breaker.Settings) string {
+  if settings.Isolation == breaker.PoolIsolation {
+    return "THREAD"
+  }
+
+  return "SEMAPHORE"
+}
+
+func milliseconds(d time.Duration) int64 {
+  return int64(d / time.Millisecond)
+}
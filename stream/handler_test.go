@@ -0,0 +1,103 @@
+package stream
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "bufio"
+  "context"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "time"
+  "breaker"
+)
+
+func Test_Handler(t *testing.T) {
+  Convey("stream metrics of registry circuits", t, func() {
+    registry := breaker.NewRegistry()
+    circuit := registry.NewCircuit("payments", breaker.Settings{MaxConcurrentCalls: 5})
+
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      time.Sleep(time.Millisecond * 20)
+      return nil
+    }, nil)
+    circuit.Do(context.Background(), func(ctx context.Context) error {
+      return fmt.Errorf("exec failure")
+    }, func(ctx context.Context, err error) error {
+      return nil
+    })
+
+    events := serve(NewHandler(registry, time.Millisecond*10), time.Millisecond*35)
+
+    Convey("events are streamed on every interval", func() {
+      So(len(events), ShouldBeGreaterThanOrEqualTo, 4)
+    })
+
+    Convey("command event is sent", func() {
+      command := events[0]
+      So(command["type"], ShouldEqual, "HystrixCommand")
+      So(command["name"], ShouldEqual, "payments")
+      So(command["requestCount"], ShouldEqual, 2)
+      So(command["errorCount"], ShouldEqual, 1)
+      So(command["errorPercentage"], ShouldEqual, 50)
+      So(command["rollingCountSuccess"], ShouldEqual, 1)
+      So(command["rollingCountFailure"], ShouldEqual, 1)
+      So(command["rollingCountFallbackSuccess"], ShouldEqual, 1)
+      So(command["isCircuitBreakerOpen"], ShouldEqual, false)
+      So(command["propertyValue_circuitBreakerForceOpen"], ShouldEqual, false)
+      So(command["propertyValue_circuitBreakerForceClosed"], ShouldEqual, false)
+      So(command["propertyValue_executionIsolationSemaphoreMaxConcurrentRequests"], ShouldEqual, 5)
+      So(command["latencyExecute"].(map[string]interface{})["100"], ShouldBeGreaterThanOrEqualTo, 20)
+      So(command["latencyTotal"].(map[string]interface{})["0"], ShouldBeLessThan, 20)
+    })
+
+    Convey("thread pool event is sent", func() {
+      threadPool := events[1]
+      So(threadPool["type"], ShouldEqual, "HystrixThreadPool")
+      So(threadPool["name"], ShouldEqual, "payments")
+      So(threadPool["currentActiveCount"], ShouldEqual, 0)
+      So(threadPool["currentPoolSize"], ShouldEqual, 5)
+    })
+  })
+
+  Convey("stream metrics of forced open circuit", t, func() {
+    registry := breaker.NewRegistry()
+    registry.NewCircuit("payments", breaker.Settings{}).ForceOpen()
+
+    events := serve(NewHandler(registry, time.Millisecond*10), time.Millisecond*25)
+
+    Convey("forced mode is sent", func() {
+      command := events[0]
+      So(command["isCircuitBreakerOpen"], ShouldEqual, true)
+      So(command["propertyValue_circuitBreakerForceOpen"], ShouldEqual, true)
+      So(command["propertyValue_circuitBreakerForceClosed"], ShouldEqual, false)
+    })
+  })
+}
+
+// runs handler for duration and returns parsed events
+func serve(handler http.Handler, duration time.Duration) []map[string]interface{} {
+  ctx, cancel := context.WithTimeout(context.Background(), duration)
+  defer cancel()
+
+  request := httptest.NewRequest("GET", "/hystrix.stream", nil).WithContext(ctx)
+  recorder := httptest.NewRecorder()
+  handler.ServeHTTP(recorder, request)
+
+  var events []map[string]interface{}
+
+  scanner := bufio.NewScanner(recorder.Body)
+  for scanner.Scan() {
+    line := scanner.Text()
+
+    if strings.HasPrefix(line, "data: ") {
+      event := map[string]interface{}{}
+      json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+      events = append(events, event)
+    }
+  }
+
+  return events
+}
@@ -0,0 +1,215 @@
+package sync
+
+import (
+  "math"
+  "sync"
+  "time"
+)
+
+// limiter adjusting its size from observed calls
+type AdaptiveLimiter interface {
+  Limiter
+  // current max number of tickets
+  Limit() int
+  // latency of call made with ticket, dropped if call failed or timed out
+  Observe(latency time.Duration, dropped bool)
+}
+
+const (
+  // limit multiplier on dropped call
+  backoffRatio = 0.9
+  // weight of new gradient limit
+  gradientSmoothing = 0.2
+  // limit is lowered at most by half per sample
+  minGradient = 0.5
+  // samples after which no load latency is measured again
+  gradientProbeInterval = 1000
+)
+
+// computes new limit from sample
+type limitAlgorithm interface {
+  update(limit float64, inflight int, latency time.Duration, dropped bool) float64
+}
+
+// ticket pool of max limit size with tickets above limit withheld from it
+// limit changes park free tickets or ones returned later, pool itself is only resized by Resize
+// Resize changes max limit, limit starts at max and is kept between min and max
+type adaptiveLimiter struct {
+  tickets   *limiter
+  algorithm limitAlgorithm
+  mutex     sync.Mutex
+  limit     float64
+  applied   int // whole number of tickets limit allows
+  minLimit  int
+  maxLimit  int
+  parked    []*struct{} // tickets withheld from pool
+  debt      int         // tickets to withhold once they are returned
+}
+
+// additive increase, multiplicative decrease
+// limit grows by one with every successful call made while at least half of limit was in use
+// and is lowered by backoff ratio with every dropped call
+func NewAIMDLimiter(minLimit int, maxLimit int) AdaptiveLimiter {
+  return newAdaptiveLimiter(&aimd{}, minLimit, maxLimit)
+}
+
+// vegas like limiter following ratio of no load latency to current latency
+// limit is lowered when calls get slower and grows by square root of limit while latency stays the same
+func NewGradientLimiter(minLimit int, maxLimit int) AdaptiveLimiter {
+  return newAdaptiveLimiter(&gradient{}, minLimit, maxLimit)
+}
+
+func newAdaptiveLimiter(algorithm limitAlgorithm, minLimit int, maxLimit int) *adaptiveLimiter {
+  return &adaptiveLimiter{
+    tickets:   newLimiter(maxLimit),
+    algorithm: algorithm,
+    limit:     float64(maxLimit),
+    applied:   maxLimit,
+    parked:    []*struct{}{},
+    minLimit:  minLimit,
+    maxLimit:  maxLimit,
+  }
+}
+
+func (limiter *adaptiveLimiter) Take() <-chan *struct{} {
+  return limiter.tickets.Take()
+}
+
+func (limiter *adaptiveLimiter) TakeOrNil() *struct{} {
+  return limiter.tickets.TakeOrNil()
+}
+
+// number of free tickets, withheld ones are not counted
+func (limiter *adaptiveLimiter) Size() int {
+  return limiter.tickets.Size()
+}
+
+func (limiter *adaptiveLimiter) Limit() int {
+  limiter.mutex.Lock()
+  defer limiter.mutex.Unlock()
+
+  return limiter.applied
+}
+
+func (limiter *adaptiveLimiter) Observe(latency time.Duration, dropped bool) {
+  limiter.mutex.Lock()
+  defer limiter.mutex.Unlock()
+
+  inflight := limiter.maxLimit - len(limiter.parked) - limiter.tickets.Size()
+  limiter.limit = limiter.algorithm.update(limiter.limit, inflight, latency, dropped)
+  limiter.apply()
+}
+
+// ticket is withheld if limit was lowered while it was taken
+func (limiter *adaptiveLimiter) Return(ticket *struct{}) {
+  if ticket == nil {
+    return
+  }
+
+  limiter.mutex.Lock()
+  defer limiter.mutex.Unlock()
+
+  if limiter.debt > 0 {
+    limiter.debt--
+    limiter.parked = append(limiter.parked, ticket)
+    return
+  }
+
+  limiter.tickets.Return(ticket)
+}
+
+// change max limit
+// tickets above limit added by resize are withheld before pool gets them
+func (limiter *adaptiveLimiter) Resize(size int) {
+  limiter.mutex.Lock()
+  defer limiter.mutex.Unlock()
+
+  if size == limiter.maxLimit {
+    return
+  }
+
+  limit := math.Max(float64(limiter.minLimit), math.Min(float64(size), limiter.limit))
+  withhold := size - int(limit) - len(limiter.parked) - limiter.debt
+  if withhold < 0 {
+    withhold = 0
+  }
+
+  withheld := limiter.tickets.resize(size, withhold)
+  limiter.parked = append(limiter.parked, withheld...)
+  limiter.debt += withhold - len(withheld)
+
+  limiter.maxLimit = size
+  limiter.apply()
+}
+
+// must be called with mutex locked
+// tickets are withheld or released only when whole number of tickets changes
+func (limiter *adaptiveLimiter) apply() {
+  limiter.limit = math.Max(float64(limiter.minLimit), math.Min(float64(limiter.maxLimit), limiter.limit))
+  limiter.applied = int(limiter.limit)
+
+  withheld := limiter.maxLimit - limiter.applied
+
+  for len(limiter.parked)+limiter.debt < withheld {
+    if ticket := limiter.tickets.TakeOrNil(); ticket != nil {
+      limiter.parked = append(limiter.parked, ticket)
+    } else {
+      limiter.debt++
+    }
+  }
+
+  for len(limiter.parked)+limiter.debt > withheld {
+    if limiter.debt > 0 {
+      limiter.debt--
+    } else {
+      last := len(limiter.parked) - 1
+      limiter.tickets.Return(limiter.parked[last])
+      limiter.parked = limiter.parked[:last]
+    }
+  }
+}
+
+type aimd struct{}
+
+func (aimd) update(limit float64, inflight int, latency time.Duration, dropped bool) float64 {
+  if dropped {
+    return limit * backoffRatio
+  }
+
+  // limit is not used up, no need to grow
+  if float64(inflight*2) < limit {
+    return limit
+  }
+
+  return limit + 1
+}
+
+type gradient struct {
+  noLoadLatency time.Duration
+  samples       int
+}
+
+func (g *gradient) update(limit float64, inflight int, latency time.Duration, dropped bool) float64 {
+  if dropped {
+    return limit * backoffRatio
+  }
+
+  if latency <= 0 {
+    return limit
+  }
+
+  g.samples++
+  if g.noLoadLatency == 0 || latency < g.noLoadLatency || g.samples%gradientProbeInterval == 0 {
+    g.noLoadLatency = latency
+  }
+
+  ratio := math.Max(minGradient, math.Min(1, float64(g.noLoadLatency)/float64(latency)))
+  newLimit := limit*ratio + math.Sqrt(limit)
+
+  // limit is not used up, only lowering is allowed
+  if float64(inflight*2) < limit {
+    newLimit = math.Min(limit, newLimit)
+  }
+
+  return limit*(1-gradientSmoothing) + newLimit*gradientSmoothing
+}
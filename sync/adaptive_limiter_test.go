@@ -0,0 +1,169 @@
+package sync
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+)
+
+func TestAIMDLimiter(t *testing.T) {
+  Convey("with aimd limiter of 2 to 10 tickets", t, func() {
+    limiter := NewAIMDLimiter(2, 10)
+
+    limit1 := limiter.Limit()
+
+    for i := 0; i < 20; i++ {
+      limiter.Observe(time.Millisecond, true)
+    }
+    limit2 := limiter.Limit()
+
+    // all tickets in use
+    ticket1 := limiter.TakeOrNil()
+    ticket2 := limiter.TakeOrNil()
+    limiter.Observe(time.Millisecond, false)
+    limit3 := limiter.Limit()
+
+    Convey("limit starts at max", func() {
+      So(limit1, ShouldEqual, 10)
+    })
+
+    Convey("dropped calls lower limit down to min", func() {
+      So(limit2, ShouldEqual, 2)
+    })
+
+    Convey("successful call under load raises limit", func() {
+      So(limit3, ShouldEqual, 3)
+      So(limiter.Size(), ShouldEqual, 1)
+    })
+
+    Convey("successful call without load keeps limit", func() {
+      limiter.Return(ticket1)
+      limiter.Return(ticket2)
+      limiter.Observe(time.Millisecond, false)
+      So(limiter.Limit(), ShouldEqual, 3)
+    })
+
+    Convey("resize lowers max limit", func() {
+      limiter.Resize(2)
+      So(limiter.Limit(), ShouldEqual, 2)
+    })
+  })
+
+  Convey("with aimd limiter of 1 to 4 tickets all taken", t, func() {
+    limiter := NewAIMDLimiter(1, 4)
+    tickets := limiter.Take()
+
+    taken := []*struct{}{}
+    for i := 0; i < 4; i++ {
+      taken = append(taken, limiter.TakeOrNil())
+    }
+
+    for i := 0; i < 10; i++ {
+      limiter.Observe(time.Millisecond, true)
+    }
+
+    for _, ticket := range taken {
+      limiter.Return(ticket)
+    }
+
+    Convey("limit changes keep ticket channel", func() {
+      So(limiter.Take() == tickets, ShouldBeTrue)
+    })
+
+    Convey("tickets returned above limit are withheld", func() {
+      So(limiter.Limit(), ShouldEqual, 1)
+      So(limiter.Size(), ShouldEqual, 1)
+    })
+
+    Convey("withheld tickets are released when limit grows", func() {
+      ticket := limiter.TakeOrNil()
+      limiter.Observe(time.Millisecond, false)
+
+      So(limiter.Limit(), ShouldEqual, 2)
+      So(limiter.Size(), ShouldEqual, 1)
+
+      limiter.Return(ticket)
+      So(limiter.Size(), ShouldEqual, 2)
+    })
+
+    Convey("resize keeps tickets above limit withheld", func() {
+      ticket := limiter.TakeOrNil()
+
+      limiter.Resize(4)
+      same := limiter.TakeOrNil()
+
+      limiter.Resize(8)
+      grown := limiter.TakeOrNil()
+
+      limiter.Resize(2)
+      limiter.Return(ticket)
+
+      So(same, ShouldBeNil)
+      So(grown, ShouldBeNil)
+      So(limiter.Limit(), ShouldEqual, 1)
+      So(limiter.Size(), ShouldEqual, 1)
+    })
+
+    Convey("waiting callers get no tickets above limit on resize", func() {
+      limiter.TakeOrNil()
+
+      waiter := make(chan *struct{}, 8)
+      for i := 0; i < 8; i++ {
+        go func() {
+          for {
+            if ticket, ok := <-limiter.Take(); ok {
+              waiter <- ticket
+              return
+            }
+          }
+        }()
+      }
+      // waiters block on ticket channel
+      time.Sleep(time.Millisecond * 10)
+
+      for i := 0; i < 100; i++ {
+        limiter.Resize(4)
+        limiter.Resize(4)
+        limiter.Resize(8)
+      }
+      time.Sleep(time.Millisecond * 10)
+
+      So(len(waiter), ShouldEqual, 0)
+    })
+  })
+}
+
+func TestGradientLimiter(t *testing.T) {
+  Convey("with gradient limiter of 1 to 100 tickets", t, func() {
+    limiter := NewGradientLimiter(1, 100)
+
+    limiter.Observe(time.Millisecond*10, false)
+    limit1 := limiter.Limit()
+
+    for i := 0; i < 20; i++ {
+      limiter.Observe(time.Millisecond*40, false)
+    }
+    limit2 := limiter.Limit()
+
+    Convey("limit is kept while latency doesn't grow", func() {
+      So(limit1, ShouldEqual, 100)
+    })
+
+    Convey("limit is lowered when latency grows", func() {
+      So(limit2, ShouldBeLessThan, 50)
+      So(limit2, ShouldBeGreaterThanOrEqualTo, 1)
+    })
+
+    Convey("limit grows back under load when latency recovers", func() {
+      for i := 0; i < limit2; i++ {
+        limiter.TakeOrNil()
+      }
+
+      for i := 0; i < 20; i++ {
+        limiter.Observe(time.Millisecond*10, false)
+      }
+
+      So(limiter.Limit(), ShouldBeGreaterThan, limit2)
+    })
+  })
+}
@@ -7,19 +7,26 @@ type Limiter interface {
   TakeOrNil() *struct{}
   Return(ticket *struct{})
   Size() int
+  Resize(size int)
 }
 
 // ticket based pool to limit number of invocations
 type limiter struct {
   tickets chan *struct{}
   maxSize int
+  issued  int // free and taken tickets, above max size after pool is shrunk
   mutex   sync.RWMutex
 }
 
 func NewLimiter(size int) Limiter {
+  return newLimiter(size)
+}
+
+func newLimiter(size int) *limiter {
   pool := &limiter{
     make(chan *struct{}, size),
     size,
+    size,
     sync.RWMutex{},
   }
 
@@ -30,13 +37,23 @@ func NewLimiter(size int) Limiter {
   return pool
 }
 
+// channel to wait for ticket on
+// channel is closed by Resize - nil ticket received from it means take should be retried
 func (limiter *limiter) Take() <-chan *struct{} {
+  limiter.mutex.RLock()
+  defer limiter.mutex.RUnlock()
+
   return limiter.tickets
 }
 
 func (limiter *limiter) TakeOrNil() *struct{} {
   select {
-  case ticket := <-limiter.tickets:
+  case ticket, ok := <-limiter.Take():
+    if !ok {
+      // pool was resized
+      return limiter.TakeOrNil()
+    }
+
     return ticket
   default:
     return nil
@@ -44,6 +61,7 @@ func (limiter *limiter) TakeOrNil() *struct{} {
 }
 
 // return ticket back to pool
+// ticket is dropped while more tickets are issued than pool size
 func (limiter *limiter) Return(ticket *struct{}) {
   if ticket == nil {
     return
@@ -52,6 +70,11 @@ func (limiter *limiter) Return(ticket *struct{}) {
   limiter.mutex.Lock()
   defer limiter.mutex.Unlock()
 
+  if limiter.issued > limiter.maxSize {
+    limiter.issued--
+    return
+  }
+
   if len(limiter.tickets) < limiter.maxSize {
     limiter.tickets <- ticket
   }
@@ -64,3 +87,58 @@ func (limiter *limiter) Size() int {
 
   return len(limiter.tickets)
 }
+
+// change max number of tickets
+// tickets taken before resize are counted against new size,
+// ones returned while taken tickets exceed new size are dropped
+func (limiter *limiter) Resize(size int) {
+  limiter.resize(size, 0)
+}
+
+// resize handing up to withhold of new free tickets to caller instead of pool
+// withheld tickets are counted as taken
+func (limiter *limiter) resize(size int, withhold int) []*struct{} {
+  limiter.mutex.Lock()
+  defer limiter.mutex.Unlock()
+
+  if size == limiter.maxSize {
+    return nil
+  }
+
+  free := 0
+
+  for drained := false; !drained; {
+    select {
+    case <-limiter.tickets:
+      free++
+    default:
+      drained = true
+    }
+  }
+
+  // tickets of previous resizes can still be taken
+  taken := limiter.issued - free
+  tickets := make(chan *struct{}, size)
+  withheld := []*struct{}{}
+
+  for i := taken; i < size; i++ {
+    if len(withheld) < withhold {
+      withheld = append(withheld, &struct{}{})
+    } else {
+      tickets <- &struct{}{}
+    }
+  }
+
+  limiter.issued = taken
+  if taken < size {
+    limiter.issued = size
+  }
+
+  // wake up callers waiting on old channel
+  close(limiter.tickets)
+
+  limiter.tickets = tickets
+  limiter.maxSize = size
+
+  return withheld
+}
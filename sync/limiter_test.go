@@ -64,3 +64,82 @@ func takeTicket(limiter Limiter) *struct{} {
     return nil
   }
 }
+
+func TestPool_Resize(t *testing.T) {
+  Convey("with 2 size pool and 1 ticket taken", t, func() {
+    pool := NewLimiter(2)
+
+    ticket := takeTicket(pool)
+    waiting := pool.Take()
+
+    Convey("grow pool", func() {
+      pool.Resize(4)
+      size1 := pool.Size()
+
+      pool.Return(ticket)
+      size2 := pool.Size()
+
+      So(size1, ShouldEqual, 3)
+      So(size2, ShouldEqual, 4)
+    })
+
+    Convey("shrink pool", func() {
+      pool.Resize(1)
+      size1 := pool.Size()
+
+      pool.Return(ticket)
+      size2 := pool.Size()
+
+      pool.Return(&struct{}{})
+      size3 := pool.Size()
+
+      So(size1, ShouldEqual, 0)
+      So(size2, ShouldEqual, 1)
+      So(size3, ShouldEqual, 1)
+    })
+
+    Convey("channel taken before resize is closed", func() {
+      pool.Resize(3)
+      _, ok := <-waiting
+
+      So(ok, ShouldBeFalse)
+      So(pool.TakeOrNil(), ShouldNotBeNil)
+    })
+  })
+}
+
+func TestPool_ShrinkBusy(t *testing.T) {
+  Convey("with 10 size pool and all tickets taken", t, func() {
+    pool := NewLimiter(10)
+
+    tickets := []*struct{}{}
+    for i := 0; i < 10; i++ {
+      tickets = append(tickets, takeTicket(pool))
+    }
+
+    pool.Resize(5)
+
+    for _, ticket := range tickets[:5] {
+      pool.Return(ticket)
+    }
+    size1 := pool.Size()
+
+    pool.Return(tickets[5])
+    size2 := pool.Size()
+
+    Convey("tickets returned above new size are dropped", func() {
+      So(size1, ShouldEqual, 0)
+      So(size2, ShouldEqual, 1)
+    })
+
+    Convey("grow counts tickets still taken", func() {
+      pool.Resize(8)
+      So(pool.Size(), ShouldEqual, 4)
+
+      for _, ticket := range tickets[6:] {
+        pool.Return(ticket)
+      }
+      So(pool.Size(), ShouldEqual, 8)
+    })
+  })
+}
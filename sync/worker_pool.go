@@ -0,0 +1,100 @@
+package sync
+
+import (
+  "sync"
+  "sync/atomic"
+)
+
+// fixed number of workers running submitted tasks
+// tasks wait in bounded queue when all workers are busy
+type WorkerPool struct {
+  tasks     chan func()
+  workers   int
+  queueSize int
+  pending   int64 // running and queued tasks
+  active    int64
+  mutex     sync.RWMutex
+  closed    bool
+}
+
+func NewWorkerPool(workers int, queueSize int) *WorkerPool {
+  pool := &WorkerPool{
+    // room for every accepted task so submit doesn't depend on idle worker being scheduled
+    tasks:     make(chan func(), workers+queueSize),
+    workers:   workers,
+    queueSize: queueSize,
+  }
+
+  for i := 0; i < workers; i++ {
+    go pool.work()
+  }
+
+  return pool
+}
+
+func (pool *WorkerPool) work() {
+  for task := range pool.tasks {
+    atomic.AddInt64(&pool.active, 1)
+    task()
+    atomic.AddInt64(&pool.active, -1)
+    atomic.AddInt64(&pool.pending, -1)
+  }
+}
+
+// queues task without blocking
+// returns false if queue is full or pool is closed
+func (pool *WorkerPool) Submit(task func()) bool {
+  pool.mutex.RLock()
+  defer pool.mutex.RUnlock()
+
+  if pool.closed {
+    return false
+  }
+
+  for {
+    pending := atomic.LoadInt64(&pool.pending)
+    if pending >= int64(pool.workers+pool.queueSize) {
+      return false
+    }
+
+    if atomic.CompareAndSwapInt64(&pool.pending, pending, pending+1) {
+      pool.tasks <- task
+      return true
+    }
+  }
+}
+
+// stops workers after queued tasks are done
+func (pool *WorkerPool) Close() {
+  pool.mutex.Lock()
+  defer pool.mutex.Unlock()
+
+  if !pool.closed {
+    pool.closed = true
+    close(pool.tasks)
+  }
+}
+
+func (pool *WorkerPool) Workers() int {
+  return pool.workers
+}
+
+// max number of queued tasks
+func (pool *WorkerPool) QueueSize() int {
+  return pool.queueSize
+}
+
+// number of workers running tasks
+func (pool *WorkerPool) Active() int {
+  return int(atomic.LoadInt64(&pool.active))
+}
+
+// number of tasks waiting for worker
+func (pool *WorkerPool) Queued() int {
+  queued := atomic.LoadInt64(&pool.pending) - atomic.LoadInt64(&pool.active)
+  if queued < 0 {
+    return 0
+  }
+
+  return int(queued)
+}
@@ -0,0 +1,65 @@
+package sync
+
+import (
+  "testing"
+  . "github.com/smartystreets/goconvey/convey"
+  "time"
+)
+
+func TestWorkerPool_Submit(t *testing.T) {
+  Convey("with pool of 1 worker and queue of 1 task", t, func() {
+    pool := NewWorkerPool(1, 1)
+    defer pool.Close()
+
+    release := make(chan struct{})
+    started := make(chan struct{})
+    done := make(chan struct{})
+
+    submitted1 := pool.Submit(func() {
+      close(started)
+      <-release
+    })
+    <-started
+
+    submitted2 := pool.Submit(func() {
+      close(done)
+    })
+    submitted3 := pool.Submit(func() {})
+
+    active := pool.Active()
+    queued := pool.Queued()
+
+    close(release)
+
+    Convey("task is run by worker", func() {
+      So(submitted1, ShouldBeTrue)
+      So(active, ShouldEqual, 1)
+    })
+
+    Convey("task waits in queue for worker", func() {
+      So(submitted2, ShouldBeTrue)
+      So(queued, ShouldEqual, 1)
+
+      select {
+      case <-done:
+      case <-time.After(time.Second):
+        t.Error("queued task was not run")
+      }
+    })
+
+    Convey("task is rejected if queue is full", func() {
+      So(submitted3, ShouldBeFalse)
+    })
+  })
+}
+
+func TestWorkerPool_Close(t *testing.T) {
+  Convey("close pool", t, func() {
+    pool := NewWorkerPool(1, 0)
+    pool.Close()
+
+    Convey("tasks are rejected", func() {
+      So(pool.Submit(func() {}), ShouldBeFalse)
+    })
+  })
+}